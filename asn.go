@@ -0,0 +1,145 @@
+package cdncheck
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gaissmai/bart"
+)
+
+// AutonomousSystem is an entry of the ip to asn table of the data
+type AutonomousSystem struct {
+	// Number is the number of the autonomous system
+	Number uint32 `yaml:"number" json:"number"`
+	// Org is the name of the organization operating the autonomous system
+	Org string `yaml:"org,omitempty" json:"org,omitempty"`
+	// Prefixes contains the ranges announced by the autonomous system
+	Prefixes []string `yaml:"prefixes,omitempty" json:"prefixes,omitempty"`
+	// parsed contains the prefixes decoded from a binary index
+	parsed []netip.Prefix
+}
+
+// ASNInfo is the autonomous system announcing an ip
+type ASNInfo struct {
+	// Number is the number of the autonomous system
+	Number uint32 `json:"number"`
+	// Org is the name of the organization operating the autonomous system
+	Org string `json:"org,omitempty"`
+	// Prefix is the most specific range of the autonomous system containing the ip
+	Prefix string `json:"prefix"`
+}
+
+// String returns the number of the autonomous system in the AS13335 form
+func (a ASNInfo) String() string {
+	return fmt.Sprintf("AS%d", a.Number)
+}
+
+// ParseASN parses an autonomous system number given either as a plain
+// number or prefixed with AS, e.g. 13335 or AS13335
+func ParseASN(value string) (uint32, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[:2], "AS") {
+		value = value[2:]
+	}
+	number, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid asn %q specified", value)
+	}
+	return uint32(number), nil
+}
+
+// asnTable finds the autonomous system announcing an address
+type asnTable struct {
+	ranger *bart.Table[uint32]
+	orgs   map[uint32]string
+}
+
+// newASNTable returns the table of the autonomous systems, or nil if there
+// are none. Overlapping prefixes resolve to the lowest number.
+func newASNTable(systems []AutonomousSystem) *asnTable {
+	if len(systems) == 0 {
+		return nil
+	}
+	table := &asnTable{ranger: new(bart.Table[uint32]), orgs: make(map[uint32]string, len(systems))}
+	for _, system := range systems {
+		table.orgs[system.Number] = system.Org
+		for _, prefix := range system.prefixes() {
+			table.ranger.Modify(prefix.Masked(), func(number uint32, ok bool) (uint32, bool) {
+				if ok && number < system.Number {
+					return number, false
+				}
+				return system.Number, false
+			})
+		}
+	}
+	return table
+}
+
+// lookup returns the autonomous system announcing the address
+func (t *asnTable) lookup(addr netip.Addr) (ASNInfo, bool) {
+	if t == nil {
+		return ASNInfo{}, false
+	}
+	prefix, number, ok := t.ranger.LookupPrefixLPM(netip.PrefixFrom(addr, addr.BitLen()))
+	if !ok {
+		return ASNInfo{}, false
+	}
+	return ASNInfo{Number: number, Org: t.orgs[number], Prefix: prefix.String()}, true
+}
+
+// prefixes returns the parsed prefixes of the autonomous system
+func (a *AutonomousSystem) prefixes() []netip.Prefix {
+	if a.parsed != nil {
+		return a.parsed
+	}
+	return parsePrefixes(a.Prefixes)
+}
+
+// mergeASN layers the ip to asn tables of data sources, an autonomous
+// system of a later layer replacing the one with the same number
+func mergeASN(layers ...*InputCompiled) []AutonomousSystem {
+	var merged []AutonomousSystem
+	for _, layer := range layers {
+		for _, system := range layer.ASN {
+			index, found := slices.BinarySearchFunc(merged, system.Number, func(item AutonomousSystem, number uint32) int {
+				return cmp.Compare(item.Number, number)
+			})
+			if found {
+				merged[index] = system
+			} else {
+				merged = slices.Insert(merged, index, system)
+			}
+		}
+	}
+	return merged
+}
+
+// setASN sets the autonomous system of the first ip of the result having one
+func (idx *dataIndex) setASN(result *Result, ips ...string) {
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		if info, ok := idx.asn.lookup(addr.Unmap()); ok {
+			result.ASN, result.ASNOrg = info.Number, info.Org
+			return
+		}
+	}
+}
+
+// LookupASN returns the autonomous system announcing an ip in the ip to
+// asn table of the data or else in the mmdb databases of the client, or
+// false if none of them has it
+func (c *Client) LookupASN(ip net.IP) (ASNInfo, bool) {
+	addr, err := toAddr(ip)
+	if err != nil {
+		return ASNInfo{}, false
+	}
+	return c.lookupASN(c.index(), addr)
+}
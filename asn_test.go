@@ -0,0 +1,59 @@
+package cdncheck
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientASN(t *testing.T) {
+	data := &InputCompiled{
+		CDN: map[string][]string{"edge": {"192.0.2.0/25"}},
+		ASN: []AutonomousSystem{
+			{Number: 64500, Org: "Edge Networks", Prefixes: []string{"192.0.2.0/24", "2001:db8::/32"}},
+			{Number: 64501, Org: "Hosting Inc", Prefixes: []string{"198.51.100.0/24"}},
+		},
+	}
+	decoded := &InputCompiled{}
+	require.Nil(t, decoded.UnmarshalBinary(mustMarshalBinary(t, data)), "could not decode binary index")
+	require.Equal(t, data.ASN[1].Prefixes, decoded.ASN[1].Prefixes, "could not round trip asn table")
+	require.Equal(t, "Hosting Inc", decoded.ASN[1].Org, "could not round trip asn org")
+
+	client, err := NewClient(WithDataSources(
+		NewStaticSource(decoded),
+		NewStaticSource(&InputCompiled{ASN: []AutonomousSystem{{Number: 64501, Org: "Hosting Inc", Prefixes: []string{"198.51.100.0/25"}}}}),
+	))
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckResult(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, result.Matched, "could not match ip")
+	require.Equal(t, uint32(64500), result.ASN, "could not get asn of matched ip")
+	require.Equal(t, "Edge Networks", result.ASNOrg, "could not get asn org of matched ip")
+
+	result, err = client.CheckResult(net.ParseIP("192.0.2.200"))
+	require.Nil(t, err, "could not check ip")
+	require.False(t, result.Matched, "could match ip")
+	require.Equal(t, uint32(64500), result.ASN, "could not get asn of unmatched ip")
+
+	info, ok := client.LookupASN(net.ParseIP("2001:db8::1"))
+	require.True(t, ok, "could not lookup ipv6 asn")
+	require.Equal(t, "AS64500", info.String(), "could not format asn")
+	require.Equal(t, "2001:db8::/32", info.Prefix, "could not get asn prefix")
+
+	_, ok = client.LookupASN(net.ParseIP("198.51.100.200"))
+	require.False(t, ok, "could not replace autonomous system of a later layer")
+	_, ok = client.LookupASN(net.ParseIP("203.0.113.1"))
+	require.False(t, ok, "could lookup unknown ip")
+
+	for value, expected := range map[string]uint32{"AS13335": 13335, "as16509": 16509, " 15169 ": 15169} {
+		number, err := ParseASN(value)
+		require.Nil(t, err, "could not parse asn %s", value)
+		require.Equal(t, expected, number, "could not parse asn %s", value)
+	}
+	for _, value := range []string{"", "AS", "ASX", "4294967296"} {
+		_, err := ParseASN(value)
+		require.NotNil(t, err, "could parse invalid asn %q", value)
+	}
+}
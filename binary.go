@@ -0,0 +1,366 @@
+package cdncheck
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/netip"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// The binary index is a compact form of the compiled data which loads
+// without parsing json and cidr strings. It is laid out as
+//
+//	magic    "CDNCHECK"
+//	version  uvarint
+//	header   names of the categories with the names of their providers
+//	body     deflate compressed ranges, then the ip to asn table, followed
+//	         by the other fields as json
+//
+// Provider names are kept out of the compressed body so they can be
+// read without decompressing the ranges. Strings and lists are prefixed
+// with their uvarint length. The ranges of a provider are masked, sorted
+// and deduplicated, then each is stored as a kind byte, the bit length
+// for IPv4 and 33 plus the bit length for IPv6, followed by the uvarint
+// difference to the previous IPv4 address of the provider or the bytes
+// of the IPv6 address covered by the bit length. The autonomous systems of
+// the ip to asn table are stored as their number, organization and ranges.
+const (
+	binaryMagic   = "CDNCHECK"
+	binaryVersion = 4
+)
+
+// IsBinaryIndex returns true if the data starts as a binary index
+func IsBinaryIndex(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(binaryMagic))
+}
+
+// MarshalBinary encodes the compiled data as a binary index.
+//
+// Ranges are stored masked, sorted and without duplicates, an invalid
+// range returns an error.
+func (i *InputCompiled) MarshalBinary() ([]byte, error) {
+	header := binary.AppendUvarint([]byte(binaryMagic), binaryVersion)
+	var body []byte
+	categories := i.rangeCategories()
+	header = binary.AppendUvarint(header, uint64(len(categories)))
+	for _, category := range categories {
+		ranges := i.CategoryRanges(category)
+		providers := slices.Sorted(maps.Keys(ranges))
+		header = appendString(header, category)
+		header = appendStrings(header, providers)
+		for _, provider := range providers {
+			var err error
+			if body, err = appendPrefixes(body, ranges[provider]); err != nil {
+				return nil, errors.Wrapf(err, "invalid range for provider %s", provider)
+			}
+		}
+	}
+	body = binary.AppendUvarint(body, uint64(len(i.ASN)))
+	for _, system := range i.ASN {
+		body = binary.AppendUvarint(body, uint64(system.Number))
+		body = appendString(body, system.Org)
+		var err error
+		if body, err = appendPrefixes(body, system.Prefixes); err != nil {
+			return nil, errors.Wrapf(err, "invalid range for AS%d", system.Number)
+		}
+	}
+	// the other fields are small compared to the ranges
+	rest := *i
+	rest.CDN, rest.WAF, rest.Cloud, rest.Ranges, rest.ASN, rest.parsed = nil, nil, nil, nil, nil, nil
+	fields, err := json.Marshal(rest)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal data")
+	}
+	body = append(body, fields...)
+
+	buffer := bytes.NewBuffer(header)
+	writer, err := flate.NewWriter(buffer, flate.BestCompression)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create compressor")
+	}
+	if _, err := writer.Write(body); err != nil {
+		return nil, errors.Wrap(err, "could not compress index")
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrap(err, "could not compress index")
+	}
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a binary index into the compiled data.
+//
+// The decoded ranges are kept parsed along with their string form, so
+// building the index of a client does not parse them again.
+func (i *InputCompiled) UnmarshalBinary(data []byte) error {
+	header, categories, err := decodeBinaryHeader(data)
+	if err != nil {
+		return err
+	}
+	reader := flate.NewReader(bytes.NewReader(data[header:]))
+	defer func() {
+		_ = reader.Close()
+	}()
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return errors.Wrap(err, "could not decompress index")
+	}
+
+	decoded := InputCompiled{}
+	parsedRanges := make(map[string]map[string][]netip.Prefix)
+	decoder := &binaryDecoder{buf: body}
+	for _, category := range categories {
+		ranges := make(map[string][]string, len(category.providers))
+		parsed := make(map[string][]netip.Prefix, len(category.providers))
+		for _, provider := range category.providers {
+			parsed[provider], ranges[provider] = decoder.prefixes()
+		}
+		parsedRanges[category.name] = parsed
+		if len(ranges) > 0 {
+			decoded.SetCategoryRanges(category.name, ranges)
+		}
+	}
+	if count := decoder.length(); count > 0 {
+		decoded.ASN = make([]AutonomousSystem, 0, count)
+		for range count {
+			number := decoder.uvarint()
+			if number > math.MaxUint32 {
+				decoder.fail(fmt.Errorf("invalid asn %d", number))
+			}
+			system := AutonomousSystem{Number: uint32(number), Org: decoder.string()}
+			system.parsed, system.Prefixes = decoder.prefixes()
+			decoded.ASN = append(decoded.ASN, system)
+		}
+	}
+	if decoder.err != nil {
+		return errors.Wrap(decoder.err, "could not decode index")
+	}
+	if err := json.Unmarshal(decoder.buf, &decoded); err != nil {
+		return errors.Wrap(err, "could not unmarshal data")
+	}
+	decoded.parsed = parsedRanges
+	*i = decoded
+	return nil
+}
+
+// binaryCategory is a category listed in the header of a binary index
+type binaryCategory struct {
+	name      string
+	providers []string
+}
+
+// decodeBinaryHeader returns the length and the categories of the header
+// of a binary index
+func decodeBinaryHeader(data []byte) (int, []binaryCategory, error) {
+	if !IsBinaryIndex(data) {
+		return 0, nil, errors.New("invalid binary index")
+	}
+	decoder := &binaryDecoder{buf: data[len(binaryMagic):]}
+	if version := decoder.uvarint(); decoder.err == nil && version != binaryVersion {
+		return 0, nil, fmt.Errorf("unsupported binary index version %d", version)
+	}
+	categories := make([]binaryCategory, 0, decoder.length())
+	for range cap(categories) {
+		categories = append(categories, binaryCategory{name: decoder.string(), providers: decoder.strings()})
+	}
+	if decoder.err != nil {
+		return 0, nil, errors.Wrap(decoder.err, "could not decode index header")
+	}
+	return len(data) - len(decoder.buf), categories, nil
+}
+
+// prefixes returns the parsed ranges of a category, skipping invalid ones
+func (i *InputCompiled) prefixes(category string) map[string][]netip.Prefix {
+	if parsed, ok := i.parsed[category]; ok {
+		return parsed
+	}
+	ranges := i.CategoryRanges(category)
+	parsed := make(map[string][]netip.Prefix, len(ranges))
+	for provider, cidrs := range ranges {
+		parsed[provider] = parsePrefixes(cidrs)
+	}
+	return parsed
+}
+
+// parsePrefixes parses the cidrs, skipping invalid ones
+func parsePrefixes(cidrs []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// comparePrefixes orders prefixes by address family, address and length
+func comparePrefixes(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
+
+// appendPrefix appends the binary form of a masked prefix following
+// the IPv4 address previous
+func appendPrefix(buf []byte, prefix netip.Prefix, previous *uint32) []byte {
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		addr := binary.BigEndian.Uint32(prefix.Addr().AsSlice())
+		buf = append(buf, byte(bits))
+		buf = binary.AppendUvarint(buf, uint64(addr-*previous))
+		*previous = addr
+		return buf
+	}
+	buf = append(buf, byte(33+bits))
+	return append(buf, prefix.Addr().AsSlice()[:(bits+7)/8]...)
+}
+
+// appendPrefixes appends the masked, sorted and deduplicated cidrs as a
+// list of prefixes
+func appendPrefixes(buf []byte, cidrs []string) ([]byte, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cidr %s", cidr)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	slices.SortFunc(prefixes, comparePrefixes)
+	prefixes = slices.Compact(prefixes)
+
+	buf = binary.AppendUvarint(buf, uint64(len(prefixes)))
+	var previous uint32
+	for _, prefix := range prefixes {
+		buf = appendPrefix(buf, prefix, &previous)
+	}
+	return buf, nil
+}
+
+// appendString appends a string
+func appendString(buf []byte, value string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// appendStrings appends a list of strings
+func appendStrings(buf []byte, values []string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(values)))
+	for _, value := range values {
+		buf = appendString(buf, value)
+	}
+	return buf
+}
+
+// binaryDecoder reads the values of a binary index. The first error is
+// kept and zero values are returned afterwards, so callers check it once.
+type binaryDecoder struct {
+	buf []byte
+	err error
+}
+
+// fail records an error if none was recorded
+func (d *binaryDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.buf = nil
+}
+
+// uvarint reads an unsigned varint
+func (d *binaryDecoder) uvarint() uint64 {
+	value, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail(errors.New("invalid varint"))
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return value
+}
+
+// length reads the length of a list, which can not exceed the remaining
+// bytes as each item takes at least one byte
+func (d *binaryDecoder) length() int {
+	value := d.uvarint()
+	if value > uint64(len(d.buf)) {
+		d.fail(fmt.Errorf("invalid length %d", value))
+		return 0
+	}
+	return int(value)
+}
+
+// bytes reads n bytes
+func (d *binaryDecoder) bytes(n int) []byte {
+	if n > len(d.buf) {
+		d.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	value := d.buf[:n]
+	d.buf = d.buf[n:]
+	return value
+}
+
+// string reads a string
+func (d *binaryDecoder) string() string {
+	return string(d.bytes(d.length()))
+}
+
+// strings reads a list of strings
+func (d *binaryDecoder) strings() []string {
+	values := make([]string, 0, d.length())
+	for range cap(values) {
+		values = append(values, d.string())
+	}
+	return values
+}
+
+// prefixes reads a list of prefixes along with their string form
+func (d *binaryDecoder) prefixes() ([]netip.Prefix, []string) {
+	prefixes := make([]netip.Prefix, 0, d.length())
+	var previous uint32
+	for range cap(prefixes) {
+		prefixes = append(prefixes, d.prefix(&previous))
+	}
+	cidrs := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		cidrs = append(cidrs, prefix.String())
+	}
+	return prefixes, cidrs
+}
+
+// prefix reads a prefix following the IPv4 address previous
+func (d *binaryDecoder) prefix(previous *uint32) netip.Prefix {
+	kind := d.bytes(1)
+	if len(kind) == 0 {
+		return netip.Prefix{}
+	}
+	bits := int(kind[0])
+	if bits <= 32 {
+		delta := d.uvarint()
+		if delta > math.MaxUint32-uint64(*previous) {
+			d.fail(fmt.Errorf("invalid address delta %d", delta))
+			return netip.Prefix{}
+		}
+		*previous += uint32(delta)
+		var addr [4]byte
+		binary.BigEndian.PutUint32(addr[:], *previous)
+		return netip.PrefixFrom(netip.AddrFrom4(addr), bits)
+	}
+	if bits -= 33; bits > 128 {
+		d.fail(fmt.Errorf("invalid prefix length %d", bits))
+		return netip.Prefix{}
+	}
+	var addr [16]byte
+	copy(addr[:], d.bytes((bits+7)/8))
+	return netip.PrefixFrom(netip.AddrFrom16(addr), bits)
+}
@@ -0,0 +1,172 @@
+package cdncheck
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryIndexRoundTrip(t *testing.T) {
+	data := &InputCompiled{
+		CDN: map[string][]string{
+			"edge":  {"198.51.100.0/24", "192.0.2.0/24", "192.0.2.0/24", "2001:db8::/32"},
+			"empty": {},
+		},
+		Cloud:            map[string][]string{"cloud": {"203.0.113.128/25", "0.0.0.0/0", "::ffff:192.0.2.0/120", "2001:db8:1::1/128"}},
+		Common:           map[string][]string{"edge": {"edge.example.net"}},
+		CommonCategories: map[string][]string{"edge": {"cdn", "waf"}},
+		Metadata: &Metadata{
+			GeneratedAt: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			Version:     "v1.0.0",
+			Providers:   []ProviderMetadata{{Category: "cdn", Provider: "edge", Prefixes: 3}},
+		},
+	}
+	encoded, err := data.MarshalBinary()
+	require.Nil(t, err, "could not marshal binary index")
+	require.True(t, IsBinaryIndex(encoded), "could not detect binary index")
+
+	decoded := &InputCompiled{}
+	require.Nil(t, decoded.UnmarshalBinary(encoded), "could not unmarshal binary index")
+	require.Equal(t, map[string][]string{
+		"edge":  {"192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32"},
+		"empty": {},
+	}, decoded.CDN, "could not get sorted cdn ranges")
+	require.Nil(t, decoded.WAF, "could get waf ranges")
+	require.Equal(t, []string{"0.0.0.0/0", "203.0.113.128/25", "::ffff:192.0.2.0/120", "2001:db8:1::1/128"}, decoded.Cloud["cloud"], "could not get cloud ranges")
+	require.Equal(t, data.Common, decoded.Common, "could not get suffixes")
+	require.Equal(t, data.CommonCategories, decoded.CommonCategories, "could not get suffix categories")
+	require.Equal(t, data.Metadata, decoded.Metadata, "could not get metadata")
+
+	client, err := NewClient(WithData(decoded))
+	require.Nil(t, err, "could not create client")
+	matched, provider, err := client.CheckCDN(net.ParseIP("2001:db8::1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, matched, "could not match decoded ipv6 range")
+	require.Equal(t, "edge", provider, "could not get correct provider")
+
+	_, err = (&InputCompiled{CDN: map[string][]string{"edge": {"192.0.2.0"}}}).MarshalBinary()
+	require.NotNil(t, err, "could marshal invalid cidr")
+}
+
+func TestBinaryIndexInvalid(t *testing.T) {
+	encoded, err := (&InputCompiled{
+		CDN:    map[string][]string{"edge": {"192.0.2.0/24", "2001:db8::/32"}},
+		Common: map[string][]string{"edge": {"edge.example.net"}},
+	}).MarshalBinary()
+	require.Nil(t, err, "could not marshal binary index")
+
+	// every truncation has to fail without panicking
+	for length := range encoded {
+		require.NotNil(t, (&InputCompiled{}).UnmarshalBinary(encoded[:length]), "could unmarshal index truncated to %d bytes", length)
+	}
+
+	unsupported := slices.Clone(encoded)
+	unsupported[len(binaryMagic)] = binaryVersion + 1
+	err = (&InputCompiled{}).UnmarshalBinary(unsupported)
+	require.ErrorContains(t, err, "unsupported binary index version", "could unmarshal unsupported version")
+
+	path := filepath.Join(t.TempDir(), "sources_data.bin")
+	require.Nil(t, os.WriteFile(path, encoded[:len(encoded)-1], 0644), "could not write index file")
+	_, err = NewClient(WithDataSources(NewFileSource(path)))
+	require.NotNil(t, err, "could create client with corrupted index")
+}
+
+// TestEmbeddedIndexUpToDate checks the binary index was generated from the
+// current sources_data.json, as both are written by generate-index
+func TestEmbeddedIndexUpToDate(t *testing.T) {
+	raw, err := os.ReadFile("sources_data.json")
+	require.Nil(t, err, "could not read json data")
+	expected := &InputCompiled{}
+	require.Nil(t, json.Unmarshal(raw, expected), "could not parse json data")
+	normalizeRanges(expected)
+
+	raw, err = os.ReadFile("sources_data.bin")
+	require.Nil(t, err, "could not read binary index")
+	actual, err := decodeData(raw)
+	require.Nil(t, err, "could not decode binary index")
+	// the parsed ranges are derived from the ranges of the categories
+	actual.parsed = nil
+
+	if !reflect.DeepEqual(expected, actual) {
+		require.Equal(t, expected, actual, "could not get data of sources_data.json")
+	}
+}
+
+func TestEmbeddedDefaultProviders(t *testing.T) {
+	data, err := embeddedData()
+	require.Nil(t, err, "could not load embedded data")
+	require.Equal(t, mapKeys(data.CDN), DefaultCDNProviders, "could not get cdn providers")
+	require.Equal(t, mapKeys(data.WAF), DefaultWafProviders, "could not get waf providers")
+	require.Equal(t, mapKeys(data.Cloud), DefaultCloudProviders, "could not get cloud providers")
+}
+
+// normalizeRanges masks, sorts and deduplicates the ranges of the data
+// the way they are stored in a binary index
+func normalizeRanges(data *InputCompiled) {
+	for _, category := range data.rangeCategories() {
+		for provider, cidrs := range data.CategoryRanges(category) {
+			prefixes := parsePrefixes(cidrs)
+			for i, prefix := range prefixes {
+				prefixes[i] = prefix.Masked()
+			}
+			slices.SortFunc(prefixes, comparePrefixes)
+			prefixes = slices.Compact(prefixes)
+			normalized := make([]string, len(prefixes))
+			for i, prefix := range prefixes {
+				normalized[i] = prefix.String()
+			}
+			data.CategoryRanges(category)[provider] = normalized
+		}
+	}
+}
+
+func TestFileSourceBinaryIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sources_data.bin")
+	encoded := mustMarshalBinary(t, &InputCompiled{CDN: map[string][]string{"edge": {"192.0.2.0/24"}}})
+	require.Nil(t, os.WriteFile(path, encoded, 0644), "could not write index file")
+
+	client, err := NewClient(WithDataSources(NewFileSource(path)))
+	require.Nil(t, err, "could not create client")
+	matched, provider, err := client.CheckCDN(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, matched, "could not match range of binary index")
+	require.Equal(t, "edge", provider, "could not get correct provider")
+}
+
+func mustMarshalBinary(t testing.TB, data *InputCompiled) []byte {
+	encoded, err := data.MarshalBinary()
+	require.Nil(t, err, "could not marshal binary index")
+	return encoded
+}
+
+// BenchmarkColdStart measures loading the provider data and building the
+// index of a client from the binary index and from sources_data.json, along
+// with the size each of them adds to binaries embedding it.
+func BenchmarkColdStart(b *testing.B) {
+	options := &clientOptions{}
+	require.Nil(b, options.validate(), "could not validate options")
+
+	for _, file := range []string{"sources_data.bin", "sources_data.json"} {
+		raw, err := os.ReadFile(file)
+		require.Nil(b, err, "could not read %s", file)
+
+		b.Run(file, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				data, err := decodeData(raw)
+				if err != nil {
+					b.Fatal(err)
+				}
+				options.newIndex(data, nil)
+			}
+			b.ReportMetric(float64(len(raw)), "embedded-bytes")
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package cdncheck
+
+import (
+	"maps"
+	"slices"
+)
+
+// CategoryInfo describes a category of providers declared by the data
+type CategoryInfo struct {
+	// Name is the name of the category, e.g. cdn or dns
+	Name string `yaml:"name" json:"name"`
+	// Description is a short description of the category
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// CategoryNames returns the categories of the data in check order.
+//
+// The declared categories come first, the default Categories being used
+// if none is declared, followed by any other category having ranges,
+// suffixes, fingerprints, certificate issuers or nameservers in the data.
+func (i *InputCompiled) CategoryNames() []string {
+	var names []string
+	for _, category := range i.Categories {
+		names = appendUnique(names, category.Name)
+	}
+	if len(names) == 0 {
+		names = slices.Clone(Categories)
+	}
+	for _, category := range Categories {
+		if len(i.CategoryRanges(category)) > 0 {
+			names = appendUnique(names, category)
+		}
+	}
+	names = appendUnique(names, slices.Sorted(maps.Keys(i.Ranges))...)
+	var suffixCategories []string
+	for _, categories := range i.CommonCategories {
+		suffixCategories = appendUnique(suffixCategories, categories...)
+	}
+	for _, categories := range i.FingerprintCategories {
+		suffixCategories = appendUnique(suffixCategories, categories...)
+	}
+	for _, categories := range i.TLSCategories {
+		suffixCategories = appendUnique(suffixCategories, categories...)
+	}
+	for provider := range i.Nameservers {
+		if categories := i.NameserverCategories[provider]; len(categories) > 0 {
+			suffixCategories = appendUnique(suffixCategories, categories...)
+		} else {
+			suffixCategories = appendUnique(suffixCategories, defaultNameserverCategory)
+		}
+	}
+	slices.Sort(suffixCategories)
+	return appendUnique(names, suffixCategories...)
+}
+
+// categoryList returns the categories of the data in check order, with
+// the description of the declared ones
+func (i *InputCompiled) categoryList() []CategoryInfo {
+	names := i.CategoryNames()
+	list := make([]CategoryInfo, 0, len(names))
+	for _, name := range names {
+		info := CategoryInfo{Name: name}
+		if index := slices.IndexFunc(i.Categories, func(item CategoryInfo) bool { return item.Name == name }); index >= 0 {
+			info = i.Categories[index]
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
+// CategoryRanges returns the ranges of the providers of a category
+func (i *InputCompiled) CategoryRanges(category string) map[string][]string {
+	switch category {
+	case "cdn":
+		return i.CDN
+	case "waf":
+		return i.WAF
+	case "cloud":
+		return i.Cloud
+	}
+	return i.Ranges[category]
+}
+
+// SetCategoryRanges sets the ranges of the providers of a category
+func (i *InputCompiled) SetCategoryRanges(category string, ranges map[string][]string) {
+	switch category {
+	case "cdn":
+		i.CDN = ranges
+	case "waf":
+		i.WAF = ranges
+	case "cloud":
+		i.Cloud = ranges
+	default:
+		if i.Ranges == nil {
+			i.Ranges = make(map[string]map[string][]string)
+		}
+		i.Ranges[category] = ranges
+	}
+}
+
+// rangeCategories returns the categories having ranges in the data, the
+// default Categories first followed by the other ones sorted by name
+func (i *InputCompiled) rangeCategories() []string {
+	return appendUnique(slices.Clone(Categories), slices.Sorted(maps.Keys(i.Ranges))...)
+}
+
+// categoryOrder returns the position of a category among the default
+// Categories, other categories being ordered after them
+func categoryOrder(category string) int {
+	if index := slices.Index(Categories, category); index >= 0 {
+		return index
+	}
+	return len(Categories)
+}
+
+// Categories returns the categories of the data loaded by the client
+// in check order, along with their description when declared
+func (c *Client) Categories() []CategoryInfo {
+	return slices.Clone(c.index().info)
+}
@@ -0,0 +1,68 @@
+package cdncheck
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataDrivenCategories(t *testing.T) {
+	data := &InputCompiled{
+		Categories: []CategoryInfo{{Name: "cdn", Description: "Content delivery networks"}, {Name: "hosting"}},
+		CDN:        map[string][]string{"edge": {"192.0.2.0/24"}},
+		Ranges:     map[string]map[string][]string{"hosting": {"racks": {"198.51.100.0/24", "2001:db8::/32"}}},
+		Common:     map[string][]string{"racks": {"racks.example"}},
+		CommonCategories: map[string][]string{
+			"racks": {"hosting", "dns"},
+		},
+		Registry: []ProviderInfo{{ID: "racks", Tags: []string{"hosting", "dns"}}},
+	}
+	require.Equal(t, []string{"cdn", "hosting", "dns"}, data.CategoryNames(), "could not get category names")
+
+	decoded := &InputCompiled{}
+	require.Nil(t, decoded.UnmarshalBinary(mustMarshalBinary(t, data)), "could not decode binary index")
+	require.Equal(t, data.Ranges, decoded.Ranges, "could not round trip category ranges")
+	require.Equal(t, data.Categories, decoded.Categories, "could not round trip declared categories")
+
+	client, err := NewClient(WithDataSources(NewStaticSource(data)))
+	require.Nil(t, err, "could not create client")
+	require.Equal(t, []CategoryInfo{
+		{Name: "cdn", Description: "Content delivery networks"},
+		{Name: "hosting"},
+		{Name: "dns"},
+	}, client.Categories(), "could not get client categories")
+
+	matched, provider, err := client.CheckCategory(net.ParseIP("2001:db8::1"), "hosting")
+	require.Nil(t, err, "could not check category")
+	require.True(t, matched, "could not match ip of custom category")
+	require.Equal(t, "racks", provider, "could not get provider of custom category")
+
+	_, _, err = client.CheckCategory(net.ParseIP("198.51.100.1"), "waf")
+	require.NotNil(t, err, "could check undeclared category")
+	_, _, err = client.CheckWAF(net.ParseIP("198.51.100.1"))
+	require.NotNil(t, err, "could check waf without waf data")
+
+	matched, provider, category, err := client.Check(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, matched, "could not match ip of custom category")
+	require.Equal(t, "hosting", category, "could not get custom category")
+	require.Equal(t, "racks", provider, "could not get provider")
+
+	require.Len(t, client.ProvidersWithTag("DNS"), 1, "could not get providers by tag")
+
+	require.Nil(t, client.AddProvider(Provider{Category: "dns", Name: "resolver", CIDRs: []string{"203.0.113.0/24"}}), "could not add provider to suffix category")
+	matched, _, err = client.CheckCategory(net.ParseIP("203.0.113.1"), "dns")
+	require.Nil(t, err, "could not check added provider")
+	require.True(t, matched, "could not match added provider")
+	require.NotNil(t, client.AddProvider(Provider{Category: "unknown", Name: "other"}), "could add provider to unknown category")
+
+	_, err = NewClient(WithDataSources(NewStaticSource(data)), WithCategories("waf"))
+	require.NotNil(t, err, "could create client with category missing from data")
+
+	restricted, err := NewClient(WithDataSources(NewStaticSource(data)), WithCategories("hosting"))
+	require.Nil(t, err, "could not create client with custom category")
+	matched, _, _, err = restricted.Check(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.False(t, matched, "could match ip of disabled category")
+}
@@ -1,14 +1,27 @@
 package cdncheck
 
 import (
+	"context"
+	"fmt"
+	"maps"
 	"net"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/retryabledns"
+	stringsutil "github.com/projectdiscovery/utils/strings"
 )
 
+// DefaultCDNProviders, DefaultWafProviders and DefaultCloudProviders list the
+// providers having ranges in the embedded data by the names used in the data,
+// which InputCompiled.CategoryProviderIDs maps to registry ids
 var (
 	DefaultCDNProviders   string
 	DefaultWafProviders   string
@@ -31,6 +44,10 @@ var IPv6Resolvers = []string{
 	"[2001:4860:4860::8844]:53",
 }
 
+// hasIPv6Connectivity reports whether IPv6 connectivity is available.
+// The check runs once, the first time a client needs to know it.
+var hasIPv6Connectivity = sync.OnceValue(checkIPv6Connectivity)
+
 // checkIPv6Connectivity tests if IPv6 connectivity is available
 func checkIPv6Connectivity() bool {
 	// Test with a well-known IPv6 DNS server
@@ -39,162 +56,428 @@ func checkIPv6Connectivity() bool {
 	if err != nil {
 		return false
 	}
-	conn.Close()
+	_ = conn.Close()
 	return true
 }
 
-// init checks for IPv6 connectivity and adds IPv6 resolvers if available
-func init() {
-	if checkIPv6Connectivity() {
-		DefaultResolvers = append(DefaultResolvers, IPv6Resolvers...)
-	}
-}
-
 // Client checks for CDN based IPs which should be excluded
 // during scans since they belong to third party firewalls.
 type Client struct {
-	sync.Once
-	cdn          *providerScraper
-	waf          *providerScraper
-	cloud        *providerScraper
-	retriabledns *retryabledns.Client
+	// data is the index of the provider data swapped on reloads
+	data atomic.Pointer[dataIndex]
+	// reloads counts the reloads started so an earlier one finishing last
+	// does not replace the data of a later one
+	reloads atomic.Uint64
+	// mutex guards the loaded data, the reload it comes from and the custom
+	// providers the index is built from
+	mutex        sync.Mutex
+	loaded       *InputCompiled
+	loadedReload uint64
+	providers    map[string]map[string]*customProvider
+	options      *clientOptions
+	dnsClient    *dnsClient
+	// fallbackdns is an IPv4 only client used when IPv6 resolvers fail
+	fallbackdns   *dnsClient
+	ipv6Failed    atomic.Bool
+	maxCNAMEDepth int
+	cache         Cache
+	logger        *gologger.Logger
 }
 
 // New creates cdncheck client with default options
-// NewWithOpts should be preferred over this function
-func New() *Client {
-	client, _ := NewWithOpts(3, []string{})
-	return client
+// NewClient should be preferred over this function
+func New() (*Client, error) {
+	return NewClient()
 }
 
 // NewWithOpts creates cdncheck client with custom options
+// NewClient should be preferred over this function
 func NewWithOpts(MaxRetries int, resolvers []string) (*Client, error) {
-	if MaxRetries <= 0 {
-		MaxRetries = 3
-	}
-	if len(resolvers) == 0 {
-		resolvers = DefaultResolvers
-	}
-	retryabledns, err := retryabledns.New(resolvers, MaxRetries)
-	if err != nil {
-		return nil, err
-	}
-	client := &Client{
-		cdn:          newProviderScraper(generatedData.CDN),
-		waf:          newProviderScraper(generatedData.WAF),
-		cloud:        newProviderScraper(generatedData.Cloud),
-		retriabledns: retryabledns,
-	}
-	return client, nil
+	return NewClient(WithMaxRetries(MaxRetries), WithResolvers(resolvers...))
 }
 
 // CheckCDN checks if an IP is contained in the cdn denylist
 func (c *Client) CheckCDN(ip net.IP) (matched bool, value string, err error) {
-	matched, value, err = c.cdn.Match(ip)
-	return matched, value, err
+	return c.CheckCategory(ip, "cdn")
 }
 
 // CheckWAF checks if an IP is contained in the waf denylist
 func (c *Client) CheckWAF(ip net.IP) (matched bool, value string, err error) {
-	matched, value, err = c.waf.Match(ip)
-	return matched, value, err
+	return c.CheckCategory(ip, "waf")
 }
 
 // CheckCloud checks if an IP is contained in the cloud denylist
 func (c *Client) CheckCloud(ip net.IP) (matched bool, value string, err error) {
-	matched, value, err = c.cloud.Match(ip)
-	return matched, value, err
+	return c.CheckCategory(ip, "cloud")
+}
+
+// CheckCategory checks if an IP is contained in the ranges of a category
+// of the provider data, returning an error if the data has no such category
+func (c *Client) CheckCategory(ip net.IP, category string) (matched bool, value string, err error) {
+	index := c.index()
+	scraper := index.scraper(category)
+	if scraper == nil {
+		return false, "", fmt.Errorf("invalid category %s specified", category)
+	}
+	if matched, value, err = scraper.Match(ip); matched || err != nil {
+		return matched, value, err
+	}
+	addr, _ := toAddr(ip)
+	if rule, ok := c.checkASNRules(index, addr, category); ok {
+		return true, rule.Provider, nil
+	}
+	return false, "", nil
 }
 
 // Check checks if ip belongs to one of CDN, WAF and Cloud . It is generic method for Checkxxx methods
 func (c *Client) Check(ip net.IP) (matched bool, value string, itemType string, err error) {
-	if matched, value, err = c.cdn.Match(ip); err == nil && matched && value != "" {
-		return matched, value, "cdn", nil
+	addr, err := toAddr(ip)
+	if err != nil {
+		return false, "", "", err
+	}
+	index := c.index()
+	if category, provider, _, ok := index.lookup(addr); ok {
+		provider, _ = SplitProviderPath(provider)
+		return true, provider, category, nil
+	}
+	if rule, ok := c.checkASNRules(index, addr, ""); ok {
+		return true, rule.Provider, rule.Category, nil
+	}
+	return false, "", "", nil
+}
+
+// CheckResult is same as Check but returns the matched prefix along with the provider
+func (c *Client) CheckResult(ip net.IP) (*Result, error) {
+	return c.checkResult(c.index(), ip)
+}
+
+// CheckAll returns every CDN, WAF and Cloud provider whose ranges contain the ip.
+//
+// Unlike Check which stops at the first hit, an ip belonging to several
+// categories or providers is reported once for each of them. An ip matching
+// no ranges is reported for every provider whose asn rules match it.
+func (c *Client) CheckAll(ip net.IP) ([]Match, error) {
+	addr, err := toAddr(ip)
+	if err != nil {
+		return nil, err
 	}
-	if matched, value, err = c.waf.Match(ip); err == nil && matched && value != "" {
-		return matched, value, "waf", nil
+	index := c.index()
+	var matches []Match
+	for _, category := range index.categories {
+		categoryMatches, err := category.scraper.MatchAll(ip)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range categoryMatches {
+			match.Category = category.name
+			matches = append(matches, match)
+		}
 	}
-	if matched, value, err = c.cloud.Match(ip); err == nil && matched && value != "" {
-		return matched, value, "cloud", nil
+	if len(matches) == 0 {
+		matches = c.asnRuleMatches(index, addr)
 	}
-	return false, "", "", err
+	return matches, nil
 }
 
 // Check Domain with fallback checks if domain belongs to one of CDN, WAF and Cloud . It is generic method for Checkxxx methods
-// Since input is domain, as a fallback it queries CNAME records and checks if domain is WAF
+// Since input is domain, its A, AAAA and CNAME records are resolved once and as a fallback
+// to the resolved ips the CNAME records are checked against known suffixes
 func (c *Client) CheckDomainWithFallback(domain string) (matched bool, value string, itemType string, err error) {
-	dnsData, err := c.retriabledns.Resolve(domain)
+	return c.CheckDomainWithFallbackContext(context.Background(), domain)
+}
+
+// CheckDomainWithFallbackContext is same as CheckDomainWithFallback but aborts
+// the dns lookups once ctx is cancelled or its deadline is exceeded
+func (c *Client) CheckDomainWithFallbackContext(ctx context.Context, domain string) (matched bool, value string, itemType string, err error) {
+	result, err := c.CheckDomainWithFallbackResultContext(ctx, domain)
 	if err != nil {
 		return false, "", "", err
 	}
-	matched, value, itemType, err = c.CheckDNSResponse(dnsData)
+	matched, value, itemType = result.tuple()
+	return matched, value, itemType, nil
+}
+
+// CheckDomainWithFallbackResult is same as CheckDomainWithFallback but returns
+// the resolved ips and cname chain along with the matched provider
+func (c *Client) CheckDomainWithFallbackResult(domain string) (*Result, error) {
+	return c.CheckDomainWithFallbackResultContext(context.Background(), domain)
+}
+
+// CheckDomainWithFallbackResultContext is same as CheckDomainWithFallbackResult but aborts
+// the dns lookups once ctx is cancelled or its deadline is exceeded
+func (c *Client) CheckDomainWithFallbackResultContext(ctx context.Context, domain string) (*Result, error) {
+	dnsData, err := c.resolveChain(ctx, domain)
 	if err != nil {
-		return false, "", "", err
-	}
-	if matched {
-		return matched, value, itemType, nil
+		return nil, err
 	}
-	// resolve cname
-	dnsData, err = c.retriabledns.CNAME(domain)
+	result, err := c.CheckDNSResponseResult(dnsData)
 	if err != nil {
-		return false, "", "", err
+		return nil, err
 	}
-	return c.CheckDNSResponse(dnsData)
+	result.Input = domain
+	return result, nil
 }
 
 // CheckDNSResponse is same as CheckDomainWithFallback but takes DNS response as input
 func (c *Client) CheckDNSResponse(dnsResponse *retryabledns.DNSData) (matched bool, value string, itemType string, err error) {
-	if dnsResponse.AAAA != nil {
-		for _, ip := range dnsResponse.AAAA {
-			ipAddr := net.ParseIP(ip)
-			if ipAddr == nil {
-				continue
-			}
-			matched, value, itemType, err := c.Check(ipAddr)
-			if err != nil {
-				return false, "", "", err
-			}
-			if matched {
-				return matched, value, itemType, nil
-			}
-		}
+	// nameservers are left out so only providers of the ips and cnames are reported
+	result, err := c.checkDNSResponse(dnsResponse, false)
+	if err != nil {
+		return false, "", "", err
 	}
-	if dnsResponse.A != nil {
-		for _, ip := range dnsResponse.A {
-			ipAddr := net.ParseIP(ip)
-			if ipAddr == nil {
-				continue
-			}
-			matched, value, itemType, err := c.Check(ipAddr)
-			if err != nil {
-				return false, "", "", err
-			}
-			if matched {
-				return matched, value, itemType, nil
+	matched, value, itemType = result.tuple()
+	return matched, value, itemType, nil
+}
+
+// CheckDNSResponseResult is same as CheckDNSResponse but returns the ips and
+// cname chain of the response along with the provider attributed to each hop.
+// Unlike CheckDNSResponse, the nameservers of the response are checked
+// against the dns providers if neither its ips nor its cnames match a provider.
+func (c *Client) CheckDNSResponseResult(dnsResponse *retryabledns.DNSData) (*Result, error) {
+	return c.checkDNSResponse(dnsResponse, true)
+}
+
+// checkDNSResponse classifies a dns response, checking its nameservers
+// against the dns providers if nameservers is true
+func (c *Client) checkDNSResponse(dnsResponse *retryabledns.DNSData, nameservers bool) (*Result, error) {
+	result := &Result{Input: dnsResponse.Host}
+	result.IPs = append(result.IPs, dnsResponse.AAAA...)
+	result.IPs = append(result.IPs, dnsResponse.A...)
+	result.CNAMEs = cnameChain(dnsResponse.Host, dnsResponse)
+	// resolvers answer with whole chains, which may go past the maximum depth
+	if len(result.CNAMEs) > c.maxCNAMEDepth {
+		result.CNAMEs = result.CNAMEs[:c.maxCNAMEDepth:c.maxCNAMEDepth]
+	}
+	result.NS = slices.Clone(dnsResponse.NS)
+
+	// a single index is used so a reload cannot split the classification
+	index := c.index()
+	names := append([]string{dnsResponse.Host}, result.CNAMEs...)
+	result.Chain = make([]Hop, len(names))
+	var suffixHop *Hop
+	for i, name := range names {
+		hop := &result.Chain[i]
+		hop.Name = name
+		// the input itself is not evidence of a provider, only its cnames are
+		if i == 0 {
+			continue
+		}
+		if match, ok := index.suffixes.match(name); ok {
+			hop.Matched = true
+			hop.Category = match.categories[0]
+			hop.Categories = slices.Clone(match.categories)
+			hop.Provider = match.provider
+			hop.Suffix = match.suffix
+			hop.Method = DetectionMethodCNAME
+			hop.Evidence = append(hop.Evidence, Evidence{
+				Category: hop.Category,
+				Provider: hop.Provider,
+				Suffix:   hop.Suffix,
+				Method:   DetectionMethodCNAME,
+			})
+			if suffixHop == nil {
+				suffixHop = hop
 			}
 		}
 	}
-	if dnsResponse.CNAME != nil {
-		matched, discovered, itemType, err := c.CheckSuffix(dnsResponse.CNAME...)
+
+	// the ips belong to the last hop of the chain, the intermediate hops
+	// being classified by their names only
+	last := &result.Chain[len(result.Chain)-1]
+	last.IPs = result.IPs
+	for _, ip := range result.IPs {
+		ipAddr := net.ParseIP(ip)
+		if ipAddr == nil {
+			continue
+		}
+		ipResult, err := c.checkResult(index, ipAddr)
 		if err != nil {
-			return false, "", itemType, err
+			return nil, err
 		}
-		if matched {
-			// for now checkSuffix only checks for wafs
-			return matched, discovered, itemType, nil
+		if ipResult.Matched {
+			last.Matched = true
+			last.Category = ipResult.Category
+			last.Categories = ipResult.Categories
+			last.Provider = ipResult.Provider
+			last.Path = ipResult.Path
+			last.Prefix = ipResult.Prefix
+			last.Method = ipResult.Method
+			last.Evidence = append(last.Evidence, Evidence{
+				Category: ipResult.Category,
+				Provider: ipResult.Provider,
+				Path:     ipResult.Path,
+				Prefix:   ipResult.Prefix,
+				Method:   ipResult.Method,
+			})
+
+			result.Matched = true
+			result.Category = ipResult.Category
+			result.Categories = slices.Clone(ipResult.Categories)
+			result.Provider = ipResult.Provider
+			result.ProviderID = ipResult.ProviderID
+			result.Path = ipResult.Path
+			result.Prefix = ipResult.Prefix
+			result.Method = ipResult.Method
+			result.ASN, result.ASNOrg, result.Country = ipResult.ASN, ipResult.ASNOrg, ipResult.Country
+			return result, nil
 		}
 	}
-	return false, "", "", err
+	if suffixHop != nil {
+		result.Matched = true
+		result.Category = suffixHop.Category
+		result.Categories = slices.Clone(suffixHop.Categories)
+		result.Provider = suffixHop.Provider
+		result.Suffix = suffixHop.Suffix
+		result.Method = DetectionMethodCNAME
+	} else if nameservers {
+		// nameservers of the response identify its dns provider only
+		index.setNameservers(result, dnsResponse.NS)
+	}
+	index.setASN(result, result.IPs...)
+	c.enrich(result, result.IPs...)
+	return index.identify(result), nil
 }
 
 func (c *Client) GetDnsData(domain string) (*retryabledns.DNSData, error) {
-	return c.retriabledns.Resolve(domain)
+	return c.GetDnsDataContext(context.Background(), domain)
+}
+
+// GetDnsDataContext is same as GetDnsData but aborts the dns lookup
+// once ctx is cancelled or its deadline is exceeded
+func (c *Client) GetDnsDataContext(ctx context.Context, domain string) (*retryabledns.DNSData, error) {
+	return c.resolve(ctx, domain)
 }
 
-func mapKeys(m map[string][]string) string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+// resolve queries the A, AAAA and CNAME records of domain in parallel and
+// merges them into a single response, so a domain is resolved only once
+// for both its classification and its output.
+//
+// An error is returned only if none of the queries succeeded.
+func (c *Client) resolve(ctx context.Context, domain string) (*retryabledns.DNSData, error) {
+	requestTypes := []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME}
+	responses := make([]*retryabledns.DNSData, len(requestTypes))
+	errs := make([]error, len(requestTypes))
+
+	var wg sync.WaitGroup
+	for i, requestType := range requestTypes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], errs[i] = c.query(ctx, domain, requestType)
+		}()
+	}
+	wg.Wait()
+
+	merged := &retryabledns.DNSData{Host: domain}
+	var succeeded bool
+	for i, response := range responses {
+		if errs[i] != nil || response == nil {
+			continue
+		}
+		succeeded = true
+		merged.A = appendUnique(merged.A, response.A...)
+		merged.AAAA = appendUnique(merged.AAAA, response.AAAA...)
+		merged.CNAME = appendUnique(merged.CNAME, response.CNAME...)
+		merged.AllRecords = appendUnique(merged.AllRecords, response.AllRecords...)
+		merged.Resolver = appendUnique(merged.Resolver, response.Resolver...)
+		if merged.TTL == 0 {
+			merged.TTL = response.TTL
+		}
+		if merged.StatusCode == "" || response.StatusCodeRaw == dns.RcodeSuccess {
+			merged.StatusCode = response.StatusCode
+			merged.StatusCodeRaw = response.StatusCodeRaw
+		}
+		if response.Timestamp.After(merged.Timestamp) {
+			merged.Timestamp = response.Timestamp
+		}
+	}
+	if !succeeded {
+		// report the first failure, preferring context errors
+		for _, err := range errs {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return nil, err
+			}
+		}
+		return nil, errs[0]
+	}
+	return merged, nil
+}
+
+// query resolves the requested record types of domain honouring ctx.
+//
+// The returned error wraps context.Canceled or context.DeadlineExceeded
+// so callers can tell an aborted lookup from a failed one using errors.Is.
+func (c *Client) query(ctx context.Context, domain string, requestTypes ...uint16) (*retryabledns.DNSData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrapf(err, "could not resolve %s", domain)
+	}
+	cacheKey := fmt.Sprintf("%s:%v", domain, requestTypes)
+	if c.cache != nil {
+		if data, ok := c.cache.Get(cacheKey); ok {
+			return data, nil
+		}
+	}
+	data, err := c.queryMultiple(ctx, domain, requestTypes)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, errors.Wrapf(ctxErr, "could not resolve %s", domain)
+		}
+		c.logger.Debug().Msgf("could not resolve %s: %s", domain, err)
+		return nil, err
+	}
+	if c.cache != nil {
+		c.cache.Set(cacheKey, data)
+	}
+	return data, nil
+}
+
+// queryMultiple resolves the requested record types of domain falling back
+// to IPv4 resolvers when the IPv6 ones cannot be reached
+func (c *Client) queryMultiple(ctx context.Context, domain string, requestTypes []uint16) (*retryabledns.DNSData, error) {
+	if c.fallbackdns == nil || c.ipv6Failed.Load() {
+		dnsClient := c.dnsClient
+		if c.fallbackdns != nil {
+			dnsClient = c.fallbackdns
+		}
+		return dnsClient.queryMultiple(ctx, domain, requestTypes)
+	}
+	data, err := c.dnsClient.queryMultiple(ctx, domain, requestTypes)
+	if !isUnreachable(err) {
+		return data, err
+	}
+	c.logger.Debug().Msgf("could not resolve %s with ipv6 resolvers, falling back to ipv4: %s", domain, err)
+	data, err = c.fallbackdns.queryMultiple(ctx, domain, requestTypes)
+	if err != nil {
+		return data, err
+	}
+	// stick to ipv4 once ipv6 resolvers failed while ipv4 ones answered
+	c.ipv6Failed.Store(true)
+	return data, nil
+}
+
+// isUnreachable reports whether err comes from a missing network or
+// route to the resolver, as opposed to a resolver failing to answer
+func isUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.EADDRNOTAVAIL) {
+		return true
+	}
+	// windows reports unreachable networks with its own error codes
+	return stringsutil.ContainsAnyI(err.Error(), "no route to host", "network is unreachable", "socket operation was attempted to an unreachable network")
+}
+
+func mapKeys[V any](m map[string]V) string {
+	return strings.Join(providerRoots(slices.Collect(maps.Keys(m))), ", ")
+}
+
+// appendUnique appends items which are not already present in the slice
+func appendUnique(slice []string, items ...string) []string {
+	for _, item := range items {
+		if !slices.Contains(slice, item) {
+			slice = append(slice, item)
+		}
 	}
-	return strings.Join(keys, ", ")
+	return slice
 }
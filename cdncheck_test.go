@@ -1,14 +1,23 @@
 package cdncheck
 
 import (
+	"math/rand"
 	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 
+	"github.com/gaissmai/bart"
+	"github.com/miekg/dns"
+
 	"github.com/stretchr/testify/require"
 )
 
 func TestCDNCheckValid(t *testing.T) {
-	client := New()
+	client, err := New()
+	require.Nil(t, err, "could not create client")
 
 	found, provider, itemType, err := client.Check(net.ParseIP("2400:cb00::1"))
 	require.Equal(t, "cloudflare", provider, "could not get correct provider")
@@ -30,3 +39,335 @@ func TestCDNCheckValid(t *testing.T) {
 	require.Nil(t, err, "Could not check ip in ranger")
 	require.False(t, found, "Localhost IP found in blacklist")
 }
+
+func TestCheckAll(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	matches, err := client.CheckAll(net.ParseIP("185.143.232.1"))
+	require.Nil(t, err, "could not check ip in ranger")
+	require.Equal(t, []Match{
+		{Category: "cdn", Provider: "arvancloud", Prefix: "185.143.232.0/22"},
+		{Category: "waf", Provider: "arvancloud", Prefix: "185.143.232.0/22"},
+		{Category: "cloud", Provider: "arvancloud", Prefix: "185.143.232.0/22"},
+	}, matches, "could not get all matches")
+
+	matches, err = client.CheckAll(net.ParseIP("127.0.0.1"))
+	require.Nil(t, err, "could not check ip in ranger")
+	require.Empty(t, matches, "localhost ip found in ranges")
+}
+
+func TestCheckResult(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckResult(net.ParseIP("173.245.48.12"))
+	require.Nil(t, err, "could not check ip in ranger")
+	require.True(t, result.Matched, "could not check cloudflare ip")
+	require.Equal(t, "waf", result.Category, "could not get correct category")
+	require.Equal(t, "cloudflare", result.Provider, "could not get correct provider")
+	require.Equal(t, "173.245.48.0/20", result.Prefix, "could not get matched prefix")
+	require.Equal(t, DetectionMethodIP, result.Method, "could not get detection method")
+	require.Equal(t, []string{"173.245.48.12"}, result.IPs, "could not get checked ips")
+
+	result, err = client.CheckResult(net.ParseIP("127.0.0.1"))
+	require.Nil(t, err, "could not check ip in ranger")
+	require.False(t, result.Matched, "localhost ip found in ranges")
+}
+
+func TestProviderScraperMostSpecific(t *testing.T) {
+	scraper := newProviderScraper(map[string][]string{
+		"wide":   {"10.0.0.0/8"},
+		"narrow": {"10.1.0.0/16"},
+		"same":   {"10.0.0.0/8"},
+	})
+
+	for i := 0; i < 10; i++ {
+		matched, provider, err := scraper.Match(net.ParseIP("10.1.2.3"))
+		require.Nil(t, err, "could not match ip")
+		require.True(t, matched, "could not match ip")
+		require.Equal(t, "narrow", provider, "could not get most specific provider")
+
+		matched, provider, err = scraper.Match(net.ParseIP("10.2.2.3"))
+		require.Nil(t, err, "could not match ip")
+		require.True(t, matched, "could not match ip")
+		require.Equal(t, "same", provider, "could not get deterministic provider")
+	}
+}
+
+func TestQueryFallsBackToIPv4(t *testing.T) {
+	server := newTestDNSServer(t, "example.com. 60 IN A 173.245.48.12")
+
+	// the primary resolver fails to answer, which is no reason to fall back
+	client, err := NewClient(WithResolvers(closedUDPAddr(t)), WithMaxRetries(1))
+	require.Nil(t, err, "could not create client")
+	client.fallbackdns, err = newDNSClient([]string{server.addr}, 1, 0)
+	require.Nil(t, err, "could not create fallback dns client")
+
+	_, err = client.GetDnsData("example.com")
+	require.NotNil(t, err, "could fall back on unanswered query")
+	require.False(t, client.ipv6Failed.Load(), "could remember failed ipv6 resolvers")
+
+	// no route to the primary resolver, mimicking unreachable ipv6 resolvers
+	client.dnsClient.dialer.Control = func(network, address string, conn syscall.RawConn) error {
+		return syscall.ENETUNREACH
+	}
+	dnsData, err := client.GetDnsData("example.com")
+	require.Nil(t, err, "could not fall back to ipv4 resolvers")
+	require.Equal(t, []string{"173.245.48.12"}, dnsData.A, "could not get fallback answer")
+	require.True(t, client.ipv6Failed.Load(), "could not remember failed ipv6 resolvers")
+}
+
+func TestDefaultResolversAuto(t *testing.T) {
+	connectivity := hasIPv6Connectivity
+	defer func() {
+		hasIPv6Connectivity = connectivity
+	}()
+
+	hasIPv6Connectivity = func() bool { return true }
+	resolvers, fallback := (&clientOptions{}).defaultResolvers()
+	require.Equal(t, IPv6Resolvers, resolvers, "could not use only ipv6 resolvers first")
+	require.Equal(t, DefaultResolvers, fallback, "could not fall back to ipv4 resolvers")
+
+	hasIPv6Connectivity = func() bool { return false }
+	resolvers, fallback = (&clientOptions{}).defaultResolvers()
+	require.Equal(t, DefaultResolvers, resolvers, "could not use ipv4 resolvers without ipv6")
+	require.Empty(t, fallback, "could fall back without ipv6")
+}
+
+func TestCheckDomainWithFallbackSinglePass(t *testing.T) {
+	server := newTestDNSServer(t,
+		"www.example.com. 60 IN CNAME example.edgekey.net.",
+		"example.edgekey.net. 60 IN A 192.0.2.10",
+		"example.edgekey.net. 60 IN AAAA 2001:db8::10",
+	)
+	client, err := NewClient(WithResolvers(server.addr), WithMaxRetries(1))
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckDomainWithFallbackResult("www.example.com")
+	require.Nil(t, err, "could not check domain")
+	require.True(t, result.Matched, "could not check domain")
+	require.Equal(t, "akamai", result.Provider, "could not get correct provider")
+	require.Equal(t, "edgekey.net", result.Suffix, "could not get matched suffix")
+	require.Equal(t, []string{"2001:db8::10", "192.0.2.10"}, result.IPs, "could not get resolved ips")
+	require.Equal(t, []string{"example.edgekey.net"}, result.CNAMEs, "could not get cname chain")
+	require.Equal(t, int32(3), server.queries.Load(), "domain was not resolved in a single pass")
+}
+
+func TestCheckDomainWithFallbackFollowsChain(t *testing.T) {
+	server := newTestDNSServer(t,
+		"www.example.com. 60 IN CNAME example.com.edgekey.net.",
+		"example.com.edgekey.net. 60 IN CNAME e123.a.akamaiedge.net.",
+		"e123.a.akamaiedge.net. 60 IN A 173.245.48.12",
+	)
+	// answer one hop at a time so the chain has to be walked
+	server.flat.Store(true)
+	client, err := NewClient(WithResolvers(server.addr), WithMaxRetries(1))
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckDomainWithFallbackResult("www.example.com")
+	require.Nil(t, err, "could not check domain")
+	require.True(t, result.Matched, "could not check domain")
+	require.Equal(t, "cloudflare", result.Provider, "could not get correct provider")
+	require.Equal(t, DetectionMethodIP, result.Method, "could not get detection method")
+	require.Equal(t, []string{"example.com.edgekey.net", "e123.a.akamaiedge.net"}, result.CNAMEs, "could not get cname chain")
+	require.Equal(t, []Hop{
+		{Name: "www.example.com"},
+		{
+			Name: "example.com.edgekey.net", Matched: true, Category: "waf", Categories: []string{"waf", "cdn"}, Provider: "akamai", Suffix: "edgekey.net", Method: DetectionMethodCNAME,
+			Evidence: []Evidence{{Category: "waf", Provider: "akamai", Suffix: "edgekey.net", Method: DetectionMethodCNAME}},
+		},
+		{
+			Name: "e123.a.akamaiedge.net", Matched: true, Category: "waf", Categories: []string{"waf"}, Provider: "cloudflare", Prefix: "173.245.48.0/20", Suffix: "akamaiedge.net", Method: DetectionMethodIP, IPs: []string{"173.245.48.12"},
+			Evidence: []Evidence{
+				{Category: "waf", Provider: "akamai", Suffix: "akamaiedge.net", Method: DetectionMethodCNAME},
+				{Category: "waf", Provider: "cloudflare", Prefix: "173.245.48.0/20", Method: DetectionMethodIP},
+			},
+		},
+	}, result.Chain, "could not get classified chain")
+}
+
+func TestCheckDomainWithFallbackChainLimits(t *testing.T) {
+	server := newTestDNSServer(t,
+		"a.example.com. 60 IN CNAME b.example.com.",
+		"b.example.com. 60 IN CNAME a.example.com.",
+		"www.example.com. 60 IN CNAME one.example.net.",
+		"one.example.net. 60 IN CNAME two.example.net.",
+		"two.example.net. 60 IN CNAME three.example.net.",
+	)
+	server.flat.Store(true)
+	client, err := NewClient(WithResolvers(server.addr), WithMaxRetries(1), WithMaxCNAMEDepth(2))
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckDomainWithFallbackResult("a.example.com")
+	require.Nil(t, err, "could not check looping domain")
+	require.False(t, result.Matched, "could match looping domain")
+	require.Equal(t, []string{"b.example.com"}, result.CNAMEs, "could not stop at cname loop")
+
+	result, err = client.CheckDomainWithFallbackResult("www.example.com")
+	require.Nil(t, err, "could not check domain")
+	require.Equal(t, []string{"one.example.net", "two.example.net"}, result.CNAMEs, "could not stop at max depth")
+
+	// chains answered at once are truncated to the max depth as well
+	server.flat.Store(false)
+	result, err = client.CheckDomainWithFallbackResult("www.example.com")
+	require.Nil(t, err, "could not check domain")
+	require.Equal(t, []string{"one.example.net", "two.example.net"}, result.CNAMEs, "could not truncate chain to max depth")
+	require.Len(t, result.Chain, 3, "could not truncate classified chain to max depth")
+}
+
+// testDNSServer is a local dns server used as resolver in tests
+type testDNSServer struct {
+	addr    string
+	queries atomic.Int32
+	// flat disables following cnames for A and AAAA questions
+	flat atomic.Bool
+}
+
+// newTestDNSServer starts a local dns server answering with the records
+// provided in zone file format.
+//
+// A and AAAA questions follow CNAME records like a recursive resolver does.
+func newTestDNSServer(t testing.TB, records ...string) *testDNSServer {
+	t.Helper()
+
+	var rrs []dns.RR
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		require.Nil(t, err, "could not parse record %s", record)
+		rrs = append(rrs, rr)
+	}
+	find := func(name string, qtype uint16) []dns.RR {
+		var found []dns.RR
+		for _, rr := range rrs {
+			if strings.EqualFold(rr.Header().Name, name) && rr.Header().Rrtype == qtype {
+				found = append(found, rr)
+			}
+		}
+		return found
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "could not listen")
+	testServer := &testDNSServer{addr: conn.LocalAddr().String()}
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		testServer.queries.Add(1)
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		question := req.Question[0]
+		name := question.Name
+		for depth := 0; depth < 10; depth++ {
+			if answers := find(name, question.Qtype); len(answers) > 0 {
+				msg.Answer = append(msg.Answer, answers...)
+				break
+			}
+			cnames := find(name, dns.TypeCNAME)
+			if len(cnames) == 0 {
+				break
+			}
+			msg.Answer = append(msg.Answer, cnames[0])
+			if question.Qtype != dns.TypeA && question.Qtype != dns.TypeAAAA || testServer.flat.Load() {
+				break
+			}
+			name = cnames[0].(*dns.CNAME).Target
+		}
+		if len(msg.Answer) == 0 {
+			msg.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(msg)
+	})}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	return testServer
+}
+
+// closedUDPAddr returns a local udp address nothing listens on
+func closedUDPAddr(t testing.TB) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "could not listen")
+	addr := conn.LocalAddr().String()
+	_ = conn.Close()
+	return addr
+}
+
+// benchmarkIPs returns a deterministic pool of random IPv4 and IPv6 addresses
+func benchmarkIPs(count int) []net.IP {
+	rng := rand.New(rand.NewSource(1))
+	ips := make([]net.IP, count)
+	for i := range ips {
+		if i%4 == 0 {
+			ip := make(net.IP, net.IPv6len)
+			_, _ = rng.Read(ip)
+			// bias towards 2xxx::/4 where providers announce ranges
+			ip[0] = 0x20 | ip[0]&0x0f
+			ips[i] = ip
+			continue
+		}
+		ips[i] = net.IPv4(byte(rng.Intn(224)), byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256)))
+	}
+	return ips
+}
+
+func BenchmarkCheck(b *testing.B) {
+	client, err := New()
+	require.Nil(b, err, "could not create client")
+	ips := benchmarkIPs(1 << 20)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _, _ = client.Check(ips[i%len(ips)])
+	}
+}
+
+func BenchmarkCheckAll(b *testing.B) {
+	client, err := New()
+	require.Nil(b, err, "could not create client")
+	ips := benchmarkIPs(1 << 20)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = client.CheckAll(ips[i%len(ips)])
+	}
+}
+
+// BenchmarkCheckPerProviderTables measures the former layout which kept one
+// table per provider and looped over all of them for every lookup.
+func BenchmarkCheckPerProviderTables(b *testing.B) {
+	data, err := embeddedData()
+	require.Nil(b, err, "could not load embedded data")
+	categories := make([]map[string]*bart.Table[net.IP], 0, 3)
+	for _, ranges := range []map[string][]string{data.CDN, data.WAF, data.Cloud} {
+		rangers := make(map[string]*bart.Table[net.IP])
+		for provider, items := range ranges {
+			ranger := new(bart.Table[net.IP])
+			for _, cidr := range items {
+				if network, err := netip.ParsePrefix(cidr); err == nil {
+					ranger.Insert(network, nil)
+				}
+			}
+			rangers[provider] = ranger
+		}
+		categories = append(categories, rangers)
+	}
+	ips := benchmarkIPs(1 << 20)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parsed, _ := netip.ParseAddr(ips[i%len(ips)].String())
+	lookup:
+		for _, rangers := range categories {
+			for _, ranger := range rangers {
+				if _, contains := ranger.Lookup(parsed); contains {
+					break lookup
+				}
+			}
+		}
+	}
+}
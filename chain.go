@@ -0,0 +1,105 @@
+package cdncheck
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/projectdiscovery/retryabledns"
+)
+
+// DefaultMaxCNAMEDepth is the default maximum number of cnames followed for a domain
+const DefaultMaxCNAMEDepth = 10
+
+// resolveChain resolves domain and follows its cname chain until it ends in
+// ips, loops or grows past the maximum depth of the client.
+//
+// Recursive resolvers usually answer with the whole chain at once, so further
+// queries are only made when a response stops at a cname without addresses.
+func (c *Client) resolveChain(ctx context.Context, domain string) (*retryabledns.DNSData, error) {
+	dnsData, err := c.resolve(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	queried := map[string]struct{}{normalizeName(domain): {}}
+	for len(dnsData.A) == 0 && len(dnsData.AAAA) == 0 {
+		chain := cnameChain(domain, dnsData)
+		if len(chain) == 0 || len(chain) >= c.maxCNAMEDepth {
+			break
+		}
+		last := chain[len(chain)-1]
+		if _, ok := queried[last]; ok {
+			c.logger.Debug().Msgf("cname loop detected for %s at %s", domain, last)
+			break
+		}
+		queried[last] = struct{}{}
+
+		next, err := c.resolve(ctx, last)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			c.logger.Debug().Msgf("could not follow cname %s of %s: %s", last, domain, err)
+			break
+		}
+		dnsData.A = appendUnique(dnsData.A, next.A...)
+		dnsData.AAAA = appendUnique(dnsData.AAAA, next.AAAA...)
+		dnsData.CNAME = appendUnique(dnsData.CNAME, next.CNAME...)
+		dnsData.AllRecords = appendUnique(dnsData.AllRecords, next.AllRecords...)
+		if len(next.CNAME) == 0 && len(next.A) == 0 && len(next.AAAA) == 0 {
+			break
+		}
+	}
+	return dnsData, nil
+}
+
+// cnameChain returns the cnames of a response ordered from host to the last target.
+//
+// The chain is rebuilt from the raw records when available so it does not depend
+// on the order of the answers, and stops when a name repeats. Responses without
+// raw records fall back to the order of their cnames.
+func cnameChain(host string, dnsData *retryabledns.DNSData) []string {
+	targets := make(map[string]string)
+	for _, record := range dnsData.AllRecords {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			continue
+		}
+		if cname, ok := rr.(*dns.CNAME); ok {
+			targets[normalizeName(cname.Hdr.Name)] = normalizeName(cname.Target)
+		}
+	}
+	if len(targets) == 0 {
+		return slices.Clone(dnsData.CNAME)
+	}
+
+	var chain []string
+	name := normalizeName(host)
+	seen := map[string]struct{}{name: {}}
+	for {
+		target, ok := targets[name]
+		if !ok {
+			break
+		}
+		if _, ok := seen[target]; ok {
+			break
+		}
+		seen[target] = struct{}{}
+		chain = append(chain, target)
+		name = target
+	}
+	// keep cnames which could not be linked to the host
+	for _, cname := range dnsData.CNAME {
+		if _, ok := seen[normalizeName(cname)]; !ok {
+			seen[normalizeName(cname)] = struct{}{}
+			chain = append(chain, cname)
+		}
+	}
+	return chain
+}
+
+// normalizeName returns the lowercase form of a dns name without trailing dot
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
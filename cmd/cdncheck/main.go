@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+
 	"github.com/projectdiscovery/cdncheck/internal/runner"
 	"github.com/projectdiscovery/gologger"
 )
@@ -10,9 +14,12 @@ func main() {
 
 	newRunner := runner.NewRunner(options)
 
-	err := newRunner.Run()
+	// cancel in-flight lookups on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := newRunner.RunContext(ctx)
 	if err != nil {
 		gologger.Fatal().Msgf("Could not run cdncheck enumeration: %s\n", err)
 	}
 }
-
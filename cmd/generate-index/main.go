@@ -1,41 +1,115 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"runtime/debug"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/projectdiscovery/cdncheck"
 	"github.com/projectdiscovery/cdncheck/generate"
-	"github.com/projectdiscovery/utils/errkit"
-	"gopkg.in/yaml.v3"
 )
 
 var (
 	input  = flag.String("input", "provider.yaml", "provider file for processing")
 	output = flag.String("output", "sources_data.json", "output file for generated sources")
+	index  = flag.String("index-output", "sources_data.bin", "output file for the binary index of generated sources")
 	token  = flag.String("token", "", "Token for the ipinfo service")
+
+	asnInput  = flag.String("asn-input", "", "ip to asn table file or url in the iptoasn.com tsv format (e.g. https://iptoasn.com/data/ip2asn-combined.tsv.gz)")
+	asnOutput = flag.String("asn-output", "asn_data.bin", "output file for the binary index of the ip to asn table")
+
+	mmdbOutput = flag.String("mmdb-output", "", "output file for an mmdb export of the generated sources (e.g. sources_data.mmdb)")
+	exportData = flag.String("export", "", "sources_data.json or sources_data.bin file to export with -mmdb-output instead of generating the sources")
 )
 
 func main() {
 	flag.Parse()
 
+	if *exportData != "" {
+		if err := processExport(); err != nil {
+			log.Fatalf("[error] Could not export data: %s\n", err)
+		}
+		return
+	}
+	if *asnInput != "" {
+		if err := processASN(); err != nil {
+			log.Fatalf("[error] Could not process asn table: %s\n", err)
+		}
+		return
+	}
 	if err := process(); err != nil {
 		log.Fatalf("[error] Could not process: %s\n", err)
 	}
 }
 
+// processASN writes the ip to asn table as a binary index of its own, as
+// it is too large to be embedded along with the provider data
+func processASN() error {
+	table, err := generate.FetchASNTable(http.DefaultClient, *asnInput)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[asn] Got %d autonomous systems\n", len(table))
+	data := cdncheck.InputCompiled{
+		ASN:      table,
+		Metadata: &cdncheck.Metadata{GeneratedAt: time.Now().UTC(), Version: toolVersion()},
+	}
+	indexData, err := data.MarshalBinary()
+	if err != nil {
+		return errors.Wrap(err, "could not marshal asn table")
+	}
+	if err := os.WriteFile(*asnOutput, indexData, 0644); err != nil {
+		return errors.Wrap(err, "could not write asn table file")
+	}
+	return nil
+}
+
+// processExport writes an mmdb export of existing sources
+func processExport() error {
+	if *mmdbOutput == "" {
+		return errors.New("no mmdb output file specified with -mmdb-output")
+	}
+	data, err := cdncheck.NewFileSource(*exportData).Load(context.Background())
+	if err != nil {
+		return err
+	}
+	return writeMMDB(data)
+}
+
+// writeMMDB writes the mmdb export of the data if an output file is specified
+func writeMMDB(data *cdncheck.InputCompiled) error {
+	if *mmdbOutput == "" {
+		return nil
+	}
+	outputFile, err := os.Create(*mmdbOutput)
+	if err != nil {
+		return errors.Wrap(err, "could not create mmdb output file")
+	}
+	defer func() {
+		_ = outputFile.Close()
+	}()
+	if err := generate.WriteMMDB(outputFile, data); err != nil {
+		return err
+	}
+	fmt.Printf("[mmdb] Exported data to %s\n", *mmdbOutput)
+	return nil
+}
+
 func process() error {
-	options := &generate.Options{}
+	options := &generate.Options{Version: toolVersion()}
 	options.ParseFromEnv()
 	if *token != "" && options.IPInfoToken == "" {
 		options.IPInfoToken = *token
 	}
 
-	categories, err := parseCategoriesFromFile()
+	categories, err := generate.ParseCategoriesFromFile(*input)
 	if err != nil {
 		return err
 	}
@@ -59,7 +133,27 @@ func process() error {
 			fmt.Printf("[common/fqdn] Defined %d items for %s\n", len(items), provider)
 		}
 		data.Common = compiled.Common
+		data.CommonCategories = compiled.CommonCategories
+	}
+	for provider, fingerprints := range compiled.Fingerprints {
+		fmt.Printf("[common/http] Defined %d fingerprints for %s\n", len(fingerprints), provider)
+	}
+	data.Fingerprints = compiled.Fingerprints
+	data.FingerprintCategories = compiled.FingerprintCategories
+	for provider, issuers := range compiled.TLSIssuers {
+		fmt.Printf("[common/tls] Defined %d issuers for %s\n", len(issuers), provider)
+	}
+	data.TLSIssuers = compiled.TLSIssuers
+	data.TLSCategories = compiled.TLSCategories
+	for provider, nameservers := range compiled.Nameservers {
+		fmt.Printf("[common/ns] Defined %d nameservers for %s\n", len(nameservers), provider)
 	}
+	data.Nameservers = compiled.Nameservers
+	data.NameserverCategories = compiled.NameserverCategories
+	for provider, fingerprints := range compiled.BlockFingerprints {
+		fmt.Printf("[common/block] Defined %d block fingerprints for %s\n", len(fingerprints), provider)
+	}
+	data.BlockFingerprints = compiled.BlockFingerprints
 	if len(compiled.CDN) > 0 {
 		for provider, items := range compiled.CDN {
 			fmt.Printf("[cdn] Got %d items for %s\n", len(items), provider)
@@ -80,6 +174,15 @@ func process() error {
 		}
 		data.Cloud = compiled.Cloud
 	}
+	for category, ranges := range compiled.Ranges {
+		for provider, items := range ranges {
+			fmt.Printf("[%s] Got %d items for %s\n", category, len(items), provider)
+		}
+	}
+	data.Ranges = compiled.Ranges
+	data.Categories = compiled.Categories
+	data.Registry = compiled.Registry
+	data.Metadata = compiled.Metadata
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return errors.Wrap(err, "could not marshal json")
@@ -88,21 +191,30 @@ func process() error {
 	if err != nil {
 		return errors.Wrap(err, "could not write to output file")
 	}
-	return nil
-}
 
-func parseCategoriesFromFile() (*generate.Categories, error) {
-	file, err := os.Open(*input)
+	indexData, err := data.MarshalBinary()
 	if err != nil {
-		return nil, errkit.Wrap(err, "could not read input.yaml file")
+		return errors.Wrap(err, "could not marshal binary index")
 	}
-	defer func() {
-		_ = file.Close()
-	}()
+	if err := os.WriteFile(*index, indexData, 0644); err != nil {
+		return errors.Wrap(err, "could not write binary index file")
+	}
+	return writeMMDB(&data)
+}
 
-	categories := &generate.Categories{}
-	if err := yaml.NewDecoder(file).Decode(categories); err != nil {
-		return nil, errors.Wrap(err, "could not decode input.yaml file")
+// toolVersion returns the module version or vcs revision of the binary
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
 	}
-	return categories, nil
+	return info.Main.Version
 }
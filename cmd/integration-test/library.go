@@ -14,7 +14,10 @@ var libraryTestcases = map[string]TestCase{
 type goIntegrationTest struct{}
 
 func (h *goIntegrationTest) Execute() error {
-	client := cdncheck.New()
+	client, err := cdncheck.New()
+	if err != nil {
+		return err
+	}
 	ip := net.ParseIP("173.245.48.12")
 	// checks if an IP is contained in the cdn denylist
 	matched, val, err := client.CheckCDN(ip)
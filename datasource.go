@@ -0,0 +1,381 @@
+package cdncheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DataSource provides compiled provider data to a client
+type DataSource interface {
+	// Load returns the compiled provider data of the source
+	Load(ctx context.Context) (*InputCompiled, error)
+}
+
+// changeDetector is implemented by sources able to tell if their data
+// changed since it was last loaded, so watching does not reload them needlessly
+type changeDetector interface {
+	changed() bool
+}
+
+// embeddedData returns the data embedded in the library, decoded on
+// first use and shared by all clients
+var embeddedData = sync.OnceValues(loadEmbeddedData)
+
+// embeddedSource is the data embedded in the library
+type embeddedSource struct{}
+
+// NewEmbeddedSource returns the source of the data embedded in the library
+func NewEmbeddedSource() DataSource {
+	return embeddedSource{}
+}
+
+// Load returns the embedded data, decoded once on first use
+func (embeddedSource) Load(ctx context.Context) (*InputCompiled, error) {
+	return embeddedData()
+}
+
+// changed returns false as the embedded data never changes
+func (embeddedSource) changed() bool {
+	return false
+}
+
+// staticSource is data provided by the user
+type staticSource struct {
+	data *InputCompiled
+}
+
+// NewStaticSource returns a source of already compiled data
+func NewStaticSource(data *InputCompiled) DataSource {
+	return &staticSource{data: data}
+}
+
+// Load returns the static data
+func (s *staticSource) Load(ctx context.Context) (*InputCompiled, error) {
+	if s.data == nil {
+		return nil, errors.New("no static data specified")
+	}
+	return s.data, nil
+}
+
+// changed returns false as static data never changes
+func (s *staticSource) changed() bool {
+	return false
+}
+
+// fileSource is a data file compiled by generate-index
+type fileSource struct {
+	path string
+
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewFileSource returns a source reading the data from a binary index
+// or a json file in the format of sources_data.json generated by generate-index
+func NewFileSource(path string) DataSource {
+	return &fileSource{path: path}
+}
+
+// Load reads and parses the data file
+func (f *fileSource) Load(ctx context.Context) (*InputCompiled, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open data file %s", f.path)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	before, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not stat data file %s", f.path)
+	}
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read data file %s", f.path)
+	}
+	after, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not stat data file %s", f.path)
+	}
+	data, err := decodeData(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse data file %s", f.path)
+	}
+	f.mutex.Lock()
+	if before.ModTime().Equal(after.ModTime()) && before.Size() == after.Size() {
+		f.modTime, f.size = after.ModTime(), after.Size()
+	} else {
+		// the file was written while being read, so it is reloaded on the
+		// next poll whatever content was read
+		f.modTime, f.size = time.Time{}, -1
+	}
+	f.mutex.Unlock()
+	return data, nil
+}
+
+// changed returns true if the file was modified since it was last loaded
+func (f *fileSource) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		// reloading reports the error
+		return true
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+}
+
+// urlSource is a data document served over http(s)
+type urlSource struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewURLSource returns a source fetching the data from an http(s) url
+// serving a binary index or a document in the format of sources_data.json
+func NewURLSource(rawURL string) DataSource {
+	return &urlSource{url: rawURL, httpClient: http.DefaultClient}
+}
+
+// Load fetches and parses the data document
+func (u *urlSource) Load(ctx context.Context) (*InputCompiled, error) {
+	parsed, err := url.Parse(u.url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse data url %s", u.url)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid scheme %s specified for data url %s", parsed.Scheme, u.url)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create request for %s", u.url)
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not fetch data url %s", u.url)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch data url %s: unexpected status %d", u.url, resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read data url %s", u.url)
+	}
+	data, err := decodeData(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse data url %s", u.url)
+	}
+	return data, nil
+}
+
+// decodeData decodes a binary index, falling back to the json format
+// of sources_data.json for data not starting as one
+func decodeData(raw []byte) (*InputCompiled, error) {
+	data := &InputCompiled{}
+	if IsBinaryIndex(raw) {
+		if err := data.UnmarshalBinary(raw); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// loadSources loads the sources and layers their data in order
+func loadSources(ctx context.Context, sources []DataSource) (*InputCompiled, error) {
+	layers := make([]*InputCompiled, 0, len(sources))
+	for _, source := range sources {
+		data, err := source.Load(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load data source")
+		}
+		layers = append(layers, data)
+	}
+	return mergeData(layers...), nil
+}
+
+// mergeData layers the data, a provider of a later layer replacing
+// the same provider of the earlier ones
+func mergeData(layers ...*InputCompiled) *InputCompiled {
+	if len(layers) == 1 {
+		return layers[0]
+	}
+	merged := &InputCompiled{
+		Common:           make(map[string][]string),
+		CommonCategories: make(map[string][]string),
+		parsed:           make(map[string]map[string][]netip.Prefix),
+	}
+	for _, layer := range layers {
+		// parsed ranges of binary layers are carried over
+		for _, category := range layer.rangeCategories() {
+			if merged.CategoryRanges(category) == nil {
+				merged.SetCategoryRanges(category, make(map[string][]string))
+				merged.parsed[category] = make(map[string][]netip.Prefix)
+			}
+			ranges, parsed := merged.CategoryRanges(category), merged.parsed[category]
+			// services and regions of a provider are replaced along with it
+			roots := providerRoots(slices.Collect(maps.Keys(layer.CategoryRanges(category))))
+			for _, name := range slices.Collect(maps.Keys(ranges)) {
+				if root, _ := SplitProviderPath(name); slices.Contains(roots, root) {
+					delete(ranges, name)
+					delete(parsed, name)
+				}
+			}
+			for provider, prefixes := range layer.prefixes(category) {
+				ranges[provider], parsed[provider] = layer.CategoryRanges(category)[provider], prefixes
+			}
+		}
+		for _, category := range layer.categoryList() {
+			index := slices.IndexFunc(merged.Categories, func(item CategoryInfo) bool { return item.Name == category.Name })
+			switch {
+			case index < 0:
+				merged.Categories = append(merged.Categories, category)
+			case category.Description != "":
+				merged.Categories[index] = category
+			}
+		}
+		for provider, suffixes := range layer.Common {
+			merged.Common[provider] = suffixes
+			// categories belong to the suffixes they were declared with
+			delete(merged.CommonCategories, provider)
+		}
+		for provider, categories := range layer.CommonCategories {
+			merged.CommonCategories[provider] = categories
+		}
+		for provider, fingerprints := range layer.Fingerprints {
+			if merged.Fingerprints == nil {
+				merged.Fingerprints = make(map[string][]HTTPFingerprint)
+				merged.FingerprintCategories = make(map[string][]string)
+			}
+			merged.Fingerprints[provider] = fingerprints
+			delete(merged.FingerprintCategories, provider)
+		}
+		for provider, categories := range layer.FingerprintCategories {
+			merged.FingerprintCategories[provider] = categories
+		}
+		for provider, issuers := range layer.TLSIssuers {
+			if merged.TLSIssuers == nil {
+				merged.TLSIssuers = make(map[string][]string)
+				merged.TLSCategories = make(map[string][]string)
+			}
+			merged.TLSIssuers[provider] = issuers
+			delete(merged.TLSCategories, provider)
+		}
+		for provider, categories := range layer.TLSCategories {
+			merged.TLSCategories[provider] = categories
+		}
+		for provider, nameservers := range layer.Nameservers {
+			if merged.Nameservers == nil {
+				merged.Nameservers = make(map[string][]string)
+				merged.NameserverCategories = make(map[string][]string)
+			}
+			merged.Nameservers[provider] = nameservers
+			delete(merged.NameserverCategories, provider)
+		}
+		for provider, categories := range layer.NameserverCategories {
+			merged.NameserverCategories[provider] = categories
+		}
+		for provider, fingerprints := range layer.BlockFingerprints {
+			if merged.BlockFingerprints == nil {
+				merged.BlockFingerprints = make(map[string][]HTTPFingerprint)
+			}
+			merged.BlockFingerprints[provider] = fingerprints
+		}
+	}
+	merged.Metadata = mergeMetadata(layers...)
+	merged.Registry = mergeRegistry(layers...)
+	merged.ASN = mergeASN(layers...)
+	return merged
+}
+
+// Reload loads the data sources of the client again and swaps its index.
+//
+// Lookups in flight keep using the previous index, which also stays
+// in use if any of the sources fails to load or lacks a category the
+// client is configured with. Providers registered on the client are
+// applied over the reloaded data.
+func (c *Client) Reload(ctx context.Context) error {
+	// sources are loaded without holding the lock so a slow remote source
+	// does not block the other operations of the client
+	reload := c.reloads.Add(1)
+	data, err := loadSources(ctx, c.options.sources)
+	if err != nil {
+		return err
+	}
+	if err := c.options.validateCategories(data); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// data of a reload started earlier does not replace newer data
+	if reload < c.loadedReload {
+		return nil
+	}
+	c.loadedReload = reload
+	c.loaded = data
+	c.data.Store(c.options.buildIndex(c.loaded, c.providers))
+	c.checkDataAge()
+	return nil
+}
+
+// Watch reloads the data sources of the client every interval until ctx
+// is done. File sources are polled for modifications and reloaded only
+// once changed, while url sources are fetched again on every interval.
+//
+// Failed reloads are logged and the previous data is kept.
+func (c *Client) Watch(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid watch interval %s specified", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if !c.sourcesChanged() {
+			continue
+		}
+		if err := c.Reload(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.logger.Warning().Msgf("Could not reload provider data: %s", err)
+		}
+	}
+}
+
+// sourcesChanged returns true if any of the sources may have changed
+func (c *Client) sourcesChanged() bool {
+	for _, source := range c.options.sources {
+		detector, ok := source.(changeDetector)
+		if !ok || detector.changed() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package cdncheck
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataSourcesLayering(t *testing.T) {
+	path := writeDataFile(t, &InputCompiled{
+		CDN:    map[string][]string{"override": {"192.0.2.0/24"}},
+		Common: map[string][]string{"base": {"base.net"}},
+	})
+	client, err := NewClient(WithDataSources(
+		NewStaticSource(&InputCompiled{
+			CDN:              map[string][]string{"override": {"198.51.100.0/24"}, "base": {"203.0.113.0/24"}},
+			Common:           map[string][]string{"base": {"base.net"}},
+			CommonCategories: map[string][]string{"base": {"cloud"}},
+		}),
+		NewFileSource(path),
+	))
+	require.Nil(t, err, "could not create client")
+
+	_, provider, _, err := client.Check(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Equal(t, "override", provider, "could not get provider of later source")
+
+	found, _, _, err := client.Check(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check ip")
+	require.False(t, found, "could get replaced ranges of earlier source")
+
+	_, provider, _, err = client.Check(net.ParseIP("203.0.113.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Equal(t, "base", provider, "could not get provider of earlier source")
+
+	_, _, itemType, err := client.CheckSuffix("a.base.net")
+	require.Nil(t, err, "could not check cname")
+	require.Equal(t, defaultSuffixCategory, itemType, "could not replace categories along suffixes")
+}
+
+func TestClientReload(t *testing.T) {
+	path := writeDataFile(t, &InputCompiled{CDN: map[string][]string{"first": {"192.0.2.0/24"}}})
+	client, err := NewClient(WithDataSources(NewFileSource(path)))
+	require.Nil(t, err, "could not create client")
+
+	ip := net.ParseIP("192.0.2.1")
+	var wg sync.WaitGroup
+	var missed atomic.Bool
+	ctx, cancel := context.WithCancel(context.Background())
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// lookups are served while the index is swapped
+		for ctx.Err() == nil {
+			if found, _, _, err := client.Check(ip); err != nil || !found {
+				missed.Store(true)
+			}
+		}
+	}()
+
+	writeDataFileAt(t, path, &InputCompiled{CDN: map[string][]string{"second": {"192.0.2.0/24"}}})
+	require.Nil(t, client.Reload(context.Background()), "could not reload data")
+	cancel()
+	wg.Wait()
+	require.False(t, missed.Load(), "could not check ip during reload")
+
+	_, provider, _, err := client.Check(ip)
+	require.Nil(t, err, "could not check ip")
+	require.Equal(t, "second", provider, "could not get reloaded provider")
+
+	require.Nil(t, os.WriteFile(path, []byte("{"), 0o600), "could not write data file")
+	require.NotNil(t, client.Reload(context.Background()), "could reload invalid data")
+	_, provider, _, err = client.Check(ip)
+	require.Nil(t, err, "could not check ip")
+	require.Equal(t, "second", provider, "could not keep data after failed reload")
+}
+
+func TestClientReloadSlowSource(t *testing.T) {
+	var slow atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			<-release
+		}
+		_ = json.NewEncoder(w).Encode(&InputCompiled{CDN: map[string][]string{"remote": {"192.0.2.0/24"}}})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithDataSources(NewURLSource(server.URL)))
+	require.Nil(t, err, "could not create client")
+
+	slow.Store(true)
+	reloaded := make(chan error, 1)
+	go func() {
+		reloaded <- client.Reload(context.Background())
+	}()
+	added := make(chan error, 1)
+	go func() {
+		added <- client.AddProvider(Provider{Category: "cdn", Name: "local", CIDRs: []string{"198.51.100.0/24"}})
+	}()
+	select {
+	case err := <-added:
+		require.Nil(t, err, "could not add provider")
+	case <-time.After(5 * time.Second):
+		t.Fatal("could not add provider while a source is loading")
+	}
+	close(release)
+	require.Nil(t, <-reloaded, "could not reload data")
+
+	_, provider, _, err := client.Check(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Equal(t, "local", provider, "could not keep provider added during reload")
+}
+
+func TestClientWatch(t *testing.T) {
+	path := writeDataFile(t, &InputCompiled{CDN: map[string][]string{"first": {"192.0.2.0/24"}}})
+	client, err := NewClient(WithDataSources(NewFileSource(path)))
+	require.Nil(t, err, "could not create client")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Watch(ctx, 10*time.Millisecond)
+	}()
+
+	writeDataFileAt(t, path, &InputCompiled{CDN: map[string][]string{"second": {"192.0.2.0/24"}}})
+	// the modification time may not change within the filesystem resolution
+	require.Nil(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)), "could not touch data file")
+	require.Eventually(t, func() bool {
+		_, provider, _, err := client.Check(net.ParseIP("192.0.2.1"))
+		return err == nil && provider == "second"
+	}, 5*time.Second, 10*time.Millisecond, "could not reload modified data file")
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled, "could not stop watching")
+}
+
+func TestURLSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sources_data.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&InputCompiled{WAF: map[string][]string{"remote": {"192.0.2.0/24"}}})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithDataSources(NewURLSource(server.URL + "/sources_data.json")))
+	require.Nil(t, err, "could not create client")
+	found, provider, itemType, err := client.Check(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, found, "could not check ip")
+	require.Equal(t, "remote", provider, "could not get remote provider")
+	require.Equal(t, "waf", itemType, "could not get remote category")
+
+	_, err = NewClient(WithDataSources(NewURLSource(server.URL + "/missing.json")))
+	require.NotNil(t, err, "could load missing url")
+
+	_, err = NewClient(WithDataSources(NewURLSource("file:///etc/passwd")))
+	require.NotNil(t, err, "could load non http url")
+}
+
+func writeDataFile(t *testing.T, data *InputCompiled) string {
+	path := filepath.Join(t.TempDir(), "sources_data.json")
+	writeDataFileAt(t, path, data)
+	return path
+}
+
+func writeDataFileAt(t *testing.T, path string, data *InputCompiled) {
+	content, err := json.Marshal(data)
+	require.Nil(t, err, "could not marshal data")
+	require.Nil(t, os.WriteFile(path, content, 0o600), "could not write data file")
+}
+
+func TestClientDataInfo(t *testing.T) {
+	generatedAt := time.Now().Add(-48 * time.Hour).UTC()
+	client, err := NewClient(WithDataSources(
+		NewStaticSource(&InputCompiled{
+			CDN: map[string][]string{"base": {"192.0.2.0/24"}, "team": {"198.51.100.0/24"}},
+			Metadata: &Metadata{GeneratedAt: generatedAt, Version: "v1.0.0", Providers: []ProviderMetadata{
+				{Category: "cdn", Provider: "team", Prefixes: 1, Sources: []SourceMetadata{{Type: SourceTypeCIDR, Prefixes: 1}}},
+				{Category: "cdn", Provider: "base", Prefixes: 1, Sources: []SourceMetadata{{Type: SourceTypeURL, Source: "https://example.com", Prefixes: 1}}},
+			}},
+		}),
+		NewStaticSource(&InputCompiled{
+			CDN: map[string][]string{"team": {"203.0.113.0/24", "198.51.100.0/24"}},
+			Metadata: &Metadata{GeneratedAt: time.Now().UTC(), Version: "v1.1.0", Providers: []ProviderMetadata{
+				{Category: "cdn", Provider: "team", Prefixes: 2, Sources: []SourceMetadata{{Type: SourceTypeCIDR, Prefixes: 2}}},
+			}},
+		}),
+	))
+	require.Nil(t, err, "could not create client")
+
+	info := client.DataInfo()
+	require.NotNil(t, info, "could not get data info")
+	require.True(t, generatedAt.Equal(info.GeneratedAt), "could not get oldest generation time")
+	require.Equal(t, "v1.1.0", info.Version, "could not get latest version")
+	require.Len(t, info.Providers, 2, "could not merge provider metadata")
+	require.Equal(t, "base", info.Providers[0].Provider, "could not sort provider metadata")
+	require.Equal(t, 2, info.Providers[1].Prefixes, "could not get metadata of later source")
+
+	age, ok := info.Age()
+	require.True(t, ok, "could not get data age")
+	require.GreaterOrEqual(t, age, 48*time.Hour, "could not get data age")
+
+	client, err = NewClient(WithDataSources(
+		NewStaticSource(&InputCompiled{CDN: map[string][]string{"base": {"192.0.2.0/24"}}}),
+		NewStaticSource(&InputCompiled{
+			CDN:      map[string][]string{"team": {"198.51.100.0/24"}},
+			Metadata: &Metadata{GeneratedAt: time.Now().UTC(), Version: "v1.1.0"},
+		}),
+	))
+	require.Nil(t, err, "could not create client")
+	_, ok = client.DataInfo().Age()
+	require.False(t, ok, "could hide unknown age of base data with a fresher layer")
+	encoded, err := json.Marshal(client.DataInfo())
+	require.Nil(t, err, "could not marshal data info")
+	require.NotContains(t, string(encoded), "generated_at", "could marshal unknown generation time")
+
+	client, err = NewClient(WithData(&InputCompiled{CDN: map[string][]string{"base": {"192.0.2.0/24"}}}))
+	require.Nil(t, err, "could not create client")
+	require.Nil(t, client.DataInfo(), "could get metadata of data without any")
+}
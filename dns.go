@@ -0,0 +1,211 @@
+package cdncheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/projectdiscovery/retryabledns"
+)
+
+// dnsResolver is a resolver queried by a dnsClient
+type dnsResolver struct {
+	// network is the network of the resolver, either udp, tcp, tcp-tls or https
+	network string
+	// address is the host:port of the resolver or its url for https
+	address string
+	// get uses GET instead of POST requests for https resolvers
+	get bool
+}
+
+// parseResolver parses a resolver using the retryabledns syntax, e.g.
+// 1.1.1.1, tcp:1.1.1.1:53, dot:1.1.1.1 or doh:https://1.1.1.1/dns-query:get
+func parseResolver(value string) (dnsResolver, error) {
+	protocol, address, ok := strings.Cut(value, ":")
+	if !ok || !slices.Contains([]string{"udp", "tcp", "dot", "doh"}, protocol) {
+		protocol, address = "udp", value
+	}
+	resolver := dnsResolver{network: protocol}
+	switch protocol {
+	case "doh":
+		resolver.network = "https"
+		if trimmed, ok := strings.CutSuffix(address, ":get"); ok {
+			address, resolver.get = trimmed, true
+		} else if strings.HasSuffix(address, ":jsonapi") {
+			return resolver, fmt.Errorf("unsupported doh resolver %s", value)
+		}
+		resolver.address = strings.TrimSuffix(address, ":post")
+		return resolver, nil
+	case "dot":
+		resolver.network = "tcp-tls"
+	}
+	resolver.address = address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		port := "53"
+		if protocol == "dot" {
+			port = "853"
+		}
+		resolver.address = net.JoinHostPort(strings.Trim(address, "[]"), port)
+	}
+	return resolver, nil
+}
+
+// dnsClient resolves domains against a set of resolvers.
+//
+// Exchanges are bound to the context of the query, so cancelling it closes
+// the connection in flight and stops further retries.
+type dnsClient struct {
+	resolvers  []dnsResolver
+	maxRetries int
+	timeout    time.Duration
+	dialer     *net.Dialer
+	httpClient *http.Client
+	index      atomic.Uint32
+}
+
+// defaultDNSTimeout is the timeout of a dns exchange when none is specified
+const defaultDNSTimeout = 3 * time.Second
+
+// newDNSClient returns a dns client for the resolvers
+func newDNSClient(resolvers []string, maxRetries int, timeout time.Duration) (*dnsClient, error) {
+	if len(resolvers) == 0 {
+		return nil, errors.New("could not create dns client: no resolvers specified")
+	}
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	client := &dnsClient{
+		maxRetries: max(maxRetries, 1),
+		timeout:    timeout,
+		dialer:     &net.Dialer{},
+		httpClient: &http.Client{Timeout: timeout},
+	}
+	for _, value := range resolvers {
+		resolver, err := parseResolver(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create dns client")
+		}
+		client.resolvers = append(client.resolvers, resolver)
+	}
+	return client, nil
+}
+
+// queryMultiple resolves the requested record types of domain, retrying
+// failed exchanges on the next resolver
+func (c *dnsClient) queryMultiple(ctx context.Context, domain string, requestTypes []uint16) (*retryabledns.DNSData, error) {
+	data := &retryabledns.DNSData{Host: domain}
+	for _, requestType := range requestTypes {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(domain), requestType)
+		msg.SetEdns0(4096, false)
+
+		var err error
+		for range c.maxRetries {
+			resolver := c.resolvers[c.index.Add(1)%uint32(len(c.resolvers))]
+			var resp *dns.Msg
+			if resp, err = c.exchange(ctx, msg, resolver); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				continue
+			}
+			if err = data.ParseFromMsg(resp); err != nil {
+				continue
+			}
+			data.StatusCode = dns.RcodeToString[resp.Rcode]
+			data.StatusCodeRaw = resp.Rcode
+			data.Raw += resp.String()
+			data.RawResp = resp
+			data.Timestamp = time.Now()
+			data.Resolver = appendUnique(data.Resolver, resolver.address)
+			// a missing name is an answer, only resolver failures are retried
+			if resp.Rcode == dns.RcodeSuccess || resp.Rcode == dns.RcodeNameError {
+				break
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", retryabledns.ErrRetriesExceeded, err)
+		}
+	}
+	data.A = appendUnique(nil, data.A...)
+	data.AAAA = appendUnique(nil, data.AAAA...)
+	data.CNAME = appendUnique(nil, data.CNAME...)
+	data.NS = appendUnique(nil, data.NS...)
+	return data, nil
+}
+
+// exchange sends msg to the resolver, closing the connection once ctx is done
+func (c *dnsClient) exchange(ctx context.Context, msg *dns.Msg, resolver dnsResolver) (*dns.Msg, error) {
+	if resolver.network == "https" {
+		return c.exchangeHTTPS(ctx, msg, resolver)
+	}
+	client := &dns.Client{Net: resolver.network, Timeout: c.timeout, Dialer: c.dialer}
+	conn, err := client.DialContext(ctx, resolver.address)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	resp, _, err := client.ExchangeWithConnContext(ctx, msg, conn)
+	if err == nil && resp.Truncated && resolver.network == "udp" {
+		// retry truncated answers over tcp as the full response does not fit
+		return c.exchange(ctx, msg, dnsResolver{network: "tcp", address: resolver.address})
+	}
+	return resp, err
+}
+
+// exchangeHTTPS sends msg to a dns over https resolver as per RFC 8484
+func (c *dnsClient) exchangeHTTPS(ctx context.Context, msg *dns.Msg, resolver dnsResolver) (*dns.Msg, error) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	var req *http.Request
+	if resolver.get {
+		query := base64.RawURLEncoding.EncodeToString(packed)
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, resolver.address+"?dns="+query, nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, resolver.address, bytes.NewReader(packed))
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("Content-Type", "application/dns-message")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, resolver.address)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
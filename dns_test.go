@@ -0,0 +1,65 @@
+package cdncheck
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseResolver(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected dnsResolver
+	}{
+		{"1.1.1.1", dnsResolver{network: "udp", address: "1.1.1.1:53"}},
+		{"udp:1.1.1.1:5353", dnsResolver{network: "udp", address: "1.1.1.1:5353"}},
+		{"tcp:[2606:4700:4700::1111]", dnsResolver{network: "tcp", address: "[2606:4700:4700::1111]:53"}},
+		{"dot:1.1.1.1", dnsResolver{network: "tcp-tls", address: "1.1.1.1:853"}},
+		{"doh:https://1.1.1.1/dns-query:get", dnsResolver{network: "https", address: "https://1.1.1.1/dns-query", get: true}},
+		{"doh:https://1.1.1.1/dns-query:post", dnsResolver{network: "https", address: "https://1.1.1.1/dns-query"}},
+	}
+	for _, test := range tests {
+		resolver, err := parseResolver(test.value)
+		require.Nil(t, err, "could not parse resolver %s", test.value)
+		require.Equal(t, test.expected, resolver, "could not parse resolver %s", test.value)
+	}
+	_, err := parseResolver("doh:https://1.1.1.1/dns-query:jsonapi")
+	require.NotNil(t, err, "could parse unsupported resolver")
+}
+
+func TestDNSClientCancel(t *testing.T) {
+	// resolver which never answers, counting the queries it receives
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "could not listen")
+	defer func() {
+		_ = conn.Close()
+	}()
+	var received atomic.Int32
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			if _, _, err := conn.ReadFrom(buf); err != nil {
+				return
+			}
+			received.Add(1)
+		}
+	}()
+
+	client, err := newDNSClient([]string{conn.LocalAddr().String()}, 5, time.Minute)
+	require.Nil(t, err, "could not create dns client")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = client.queryMultiple(ctx, "example.com", []uint16{dns.TypeA, dns.TypeAAAA})
+	require.ErrorIs(t, err, context.Canceled, "could not get cancelled error")
+	require.Less(t, time.Since(start), 5*time.Second, "could not abort exchange in flight")
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int32(1), received.Load(), "could retry after cancellation")
+}
@@ -8,7 +8,10 @@ import (
 )
 
 func main() {
-	client := cdncheck.New()
+	client, err := cdncheck.New()
+	if err != nil {
+		panic(err)
+	}
 	ip := net.ParseIP("173.245.48.12")
 
 	// checks if an IP is contained in the cdn denylist
@@ -0,0 +1,133 @@
+package generate
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/projectdiscovery/cdncheck"
+)
+
+// FetchASNTable returns the ip to asn table read from a file or an url
+// in the format accepted by ParseASNTable
+func FetchASNTable(httpClient *http.Client, source string) ([]cdncheck.AutonomousSystem, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = fetchURL(httpClient, source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read asn table %s: %w", source, err)
+	}
+	return ParseASNTable(bytes.NewReader(data))
+}
+
+// ParseASNTable parses an ip to asn table in the tab separated format of
+// iptoasn.com, optionally gzip compressed. Each line holds the first and
+// last address of a range, the number of the autonomous system announcing
+// it, a country code and the organization operating it. Ranges which are
+// not routed (AS0) are skipped.
+func ParseASNTable(reader io.Reader) ([]cdncheck.AutonomousSystem, error) {
+	buffered := bufio.NewReader(reader)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress asn table: %w", err)
+		}
+		defer func() {
+			_ = gzipReader.Close()
+		}()
+		buffered = bufio.NewReader(gzipReader)
+	}
+
+	systems := make(map[uint32]*cdncheck.AutonomousSystem)
+	scanner := bufio.NewScanner(buffered)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least 3 fields in asn table", line)
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start address: %w", line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid end address: %w", line, err)
+		}
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("line %d: invalid range %s-%s", line, start, end)
+		}
+		number, err := cdncheck.ParseASN(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if number == 0 {
+			continue
+		}
+		system, ok := systems[number]
+		if !ok {
+			system = &cdncheck.AutonomousSystem{Number: number}
+			systems[number] = system
+		}
+		if len(fields) > 4 && system.Org == "" {
+			system.Org = strings.TrimSpace(fields[4])
+		}
+		for _, prefix := range rangePrefixes(start, end) {
+			system.Prefixes = append(system.Prefixes, prefix.String())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read asn table: %w", err)
+	}
+
+	table := make([]cdncheck.AutonomousSystem, 0, len(systems))
+	for _, number := range slices.Sorted(maps.Keys(systems)) {
+		table = append(table, *systems[number])
+	}
+	return table, nil
+}
+
+// rangePrefixes returns the smallest list of prefixes covering the
+// addresses from start to end, both of the same family
+func rangePrefixes(start, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for start.IsValid() && !end.Less(start) {
+		// the largest prefix starting at start which does not go past end
+		prefix := netip.PrefixFrom(start, start.BitLen())
+		for bits := 0; bits <= start.BitLen(); bits++ {
+			candidate := netip.PrefixFrom(start, bits)
+			if candidate.Masked().Addr() == start && !end.Less(lastAddr(candidate)) {
+				prefix = candidate
+				break
+			}
+		}
+		prefixes = append(prefixes, prefix)
+		start = lastAddr(prefix).Next()
+	}
+	return prefixes
+}
+
+// lastAddr returns the last address of a masked prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(addr)*8; bit++ {
+		addr[bit/8] |= 0x80 >> (bit % 8)
+	}
+	last, _ := netip.AddrFromSlice(addr)
+	return last
+}
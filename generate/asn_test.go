@@ -0,0 +1,70 @@
+package generate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/projectdiscovery/cdncheck"
+	"github.com/stretchr/testify/require"
+)
+
+const testASNTable = `1.0.0.0	1.0.0.255	13335	US	CLOUDFLARENET
+1.0.1.0	1.0.3.255	0	None	Not routed
+10.0.0.1	10.0.0.6	64500	ZZ	Example Networks
+2001:db8::	2001:db8:ffff:ffff:ffff:ffff:ffff:ffff	64500	ZZ	Example Networks
+`
+
+func TestParseASNTable(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(testASNTable))
+	require.Nil(t, err, "could not compress table")
+	require.Nil(t, writer.Close(), "could not compress table")
+
+	expected := []cdncheck.AutonomousSystem{
+		{Number: 13335, Org: "CLOUDFLARENET", Prefixes: []string{"1.0.0.0/24"}},
+		{Number: 64500, Org: "Example Networks", Prefixes: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32", "2001:db8::/32"}},
+	}
+	for name, data := range map[string][]byte{"plain": []byte(testASNTable), "gzip": compressed.Bytes()} {
+		table, err := ParseASNTable(bytes.NewReader(data))
+		require.Nil(t, err, "could not parse %s table", name)
+		require.Equal(t, expected, table, "could not get %s table", name)
+	}
+
+	for _, line := range []string{"1.0.0.0\t1.0.0.255", "1.0.0.9\t1.0.0.1\t1", "1.0.0.0\t::1\t1", "1.0.0.0\t1.0.0.1\tASX"} {
+		_, err := ParseASNTable(strings.NewReader(line))
+		require.NotNil(t, err, "could parse invalid line %q", line)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+	table, err := FetchASNTable(server.Client(), server.URL+"/ip2asn-combined.tsv.gz")
+	require.Nil(t, err, "could not fetch table")
+	require.Equal(t, expected, table, "could not get fetched table")
+}
+
+func TestRangePrefixes(t *testing.T) {
+	for _, item := range []struct {
+		start, end string
+		expected   []string
+	}{
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.255", "255.255.255.255", []string{"255.255.255.255/32"}},
+		{"192.0.2.0", "192.0.3.127", []string{"192.0.2.0/24", "192.0.3.0/25"}},
+		{"::", "::1", []string{"::/127"}},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"}},
+	} {
+		var prefixes []string
+		for _, prefix := range rangePrefixes(netip.MustParseAddr(item.start), netip.MustParseAddr(item.end)) {
+			prefixes = append(prefixes, prefix.String())
+		}
+		require.Equal(t, item.expected, prefixes, "could not get prefixes of %s-%s", item.start, item.end)
+	}
+}
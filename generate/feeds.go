@@ -0,0 +1,216 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/projectdiscovery/cdncheck"
+)
+
+// Feed is a structured list of ranges published by a provider along
+// with the service and region of each prefix
+type Feed struct {
+	// Format is the format of the feed (aws, gcp, azure, oracle)
+	Format string `yaml:"format"`
+	// URL is the url the feed is fetched from
+	URL string `yaml:"url"`
+}
+
+// feedEntry is a prefix of a feed along with its service and region
+type feedEntry struct {
+	prefix  string
+	service string
+	region  string
+}
+
+// feedParser returns the entries of the body of a feed
+type feedParser func(data []byte) ([]feedEntry, error)
+
+// feedParsers contains the parsers of the supported feed formats
+var feedParsers = map[string]feedParser{
+	"aws":    parseAWSFeed,
+	"gcp":    parseGCPFeed,
+	"azure":  parseAzureFeed,
+	"oracle": parseOracleFeed,
+}
+
+// getFeedRanges fetches a feed and returns its ranges by the hierarchical
+// name of their provider, service and region, e.g. aws/ec2/us-east-1
+func getFeedRanges(httpClient *http.Client, provider string, feed *Feed) (map[string][]string, error) {
+	parser, ok := feedParsers[feed.Format]
+	if !ok {
+		return nil, fmt.Errorf("unknown feed format %s", feed.Format)
+	}
+	data, err := fetchURL(httpClient, feed.URL)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parser(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s feed: %w", feed.Format, err)
+	}
+	ranges := make(map[string][]string)
+	for _, entry := range entries {
+		if _, err := netip.ParsePrefix(entry.prefix); err != nil {
+			fmt.Printf("skipping '%v' err: %v\n", entry.prefix, err)
+			continue
+		}
+		path := provider
+		for _, segment := range []string{entry.service, entry.region} {
+			if segment != "" {
+				path += cdncheck.PathSeparator + strings.ReplaceAll(segment, cdncheck.PathSeparator, "-")
+			}
+		}
+		ranges[path] = append(ranges[path], entry.prefix)
+	}
+	if len(ranges) == 0 {
+		return nil, errNoCidrFound
+	}
+	return ranges, nil
+}
+
+// preferSpecific keeps a single entry for each prefix, preferring the ones
+// of a service other than the generic one covering all the ranges of the
+// provider, then the ones of a region, then the first one of the feed
+func preferSpecific(entries []feedEntry, generic string) []feedEntry {
+	score := func(entry feedEntry) int {
+		var value int
+		if !strings.EqualFold(entry.service, generic) {
+			value += 2
+		}
+		if entry.region != "" {
+			value++
+		}
+		return value
+	}
+	indexes := make(map[string]int)
+	var specific []feedEntry
+	for _, entry := range entries {
+		index, ok := indexes[entry.prefix]
+		if !ok {
+			indexes[entry.prefix] = len(specific)
+			specific = append(specific, entry)
+			continue
+		}
+		if score(entry) > score(specific[index]) {
+			specific[index] = entry
+		}
+	}
+	return specific
+}
+
+// parseAWSFeed parses the ip-ranges.json feed of AWS, services being
+// lowercased and global ranges having no region
+func parseAWSFeed(data []byte) ([]feedEntry, error) {
+	type awsPrefix struct {
+		IPPrefix   string `json:"ip_prefix"`
+		IPv6Prefix string `json:"ipv6_prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+	}
+	var feed struct {
+		Prefixes     []awsPrefix `json:"prefixes"`
+		IPv6Prefixes []awsPrefix `json:"ipv6_prefixes"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+	var entries []feedEntry
+	for _, item := range slices.Concat(feed.Prefixes, feed.IPv6Prefixes) {
+		region := strings.ToLower(item.Region)
+		if region == "global" {
+			region = ""
+		}
+		entries = append(entries, feedEntry{
+			prefix:  item.IPPrefix + item.IPv6Prefix,
+			service: strings.ToLower(item.Service),
+			region:  region,
+		})
+	}
+	return preferSpecific(entries, "amazon"), nil
+}
+
+// parseGCPFeed parses the cloud.json feed of Google Cloud, services
+// being lowercased with dashes instead of spaces
+func parseGCPFeed(data []byte) ([]feedEntry, error) {
+	var feed struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+	var entries []feedEntry
+	for _, item := range feed.Prefixes {
+		entries = append(entries, feedEntry{
+			prefix:  item.IPv4Prefix + item.IPv6Prefix,
+			service: strings.ToLower(strings.Join(strings.Fields(item.Service), "-")),
+			region:  item.Scope,
+		})
+	}
+	return preferSpecific(entries, ""), nil
+}
+
+// parseAzureFeed parses the ServiceTags json feed of Azure, services
+// being the names of the tags without their region suffix
+func parseAzureFeed(data []byte) ([]feedEntry, error) {
+	var feed struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+	var entries []feedEntry
+	for _, item := range feed.Values {
+		service, region := item.Name, item.Properties.Region
+		if index := strings.LastIndex(service, "."); index > 0 && region != "" && strings.EqualFold(service[index+1:], region) {
+			service = service[:index]
+		}
+		for _, prefix := range item.Properties.AddressPrefixes {
+			entries = append(entries, feedEntry{prefix: prefix, service: service, region: region})
+		}
+	}
+	return preferSpecific(entries, "AzureCloud"), nil
+}
+
+// parseOracleFeed parses the public_ip_ranges.json feed of Oracle Cloud,
+// services being the first tag of each range lowercased
+func parseOracleFeed(data []byte) ([]feedEntry, error) {
+	var feed struct {
+		Regions []struct {
+			Region string `json:"region"`
+			CIDRs  []struct {
+				CIDR string   `json:"cidr"`
+				Tags []string `json:"tags"`
+			} `json:"cidrs"`
+		} `json:"regions"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+	var entries []feedEntry
+	for _, region := range feed.Regions {
+		for _, item := range region.CIDRs {
+			var service string
+			if len(item.Tags) > 0 {
+				service = strings.ToLower(item.Tags[0])
+			}
+			entries = append(entries, feedEntry{prefix: item.CIDR, service: service, region: region.Region})
+		}
+	}
+	return preferSpecific(entries, ""), nil
+}
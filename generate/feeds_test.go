@@ -0,0 +1,117 @@
+package generate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/projectdiscovery/cdncheck"
+	"github.com/stretchr/testify/require"
+)
+
+var testFeeds = map[string]string{
+	"/aws": `{"prefixes": [
+		{"ip_prefix": "192.0.2.0/24", "region": "us-east-1", "service": "AMAZON"},
+		{"ip_prefix": "192.0.2.0/24", "region": "us-east-1", "service": "EC2"},
+		{"ip_prefix": "198.51.100.0/24", "region": "GLOBAL", "service": "CLOUDFRONT"},
+		{"ip_prefix": "invalid", "region": "GLOBAL", "service": "CLOUDFRONT"}
+	], "ipv6_prefixes": [
+		{"ipv6_prefix": "2001:db8::/32", "region": "eu-west-1", "service": "S3"}
+	]}`,
+	"/aws-global": `{"prefixes": [
+		{"ip_prefix": "198.51.100.0/24", "region": "GLOBAL", "service": "CLOUDFRONT"},
+		{"ip_prefix": "203.0.113.0/24", "region": "GLOBAL", "service": "CLOUDFRONT"}
+	]}`,
+	"/gcp": `{"prefixes": [
+		{"ipv4Prefix": "192.0.2.0/24", "service": "Google Cloud", "scope": "us-east1"},
+		{"ipv6Prefix": "2001:db8::/32", "service": "Google Cloud", "scope": "europe-west1"}
+	]}`,
+	"/azure": `{"values": [
+		{"name": "AzureCloud", "properties": {"region": "", "addressPrefixes": ["192.0.2.0/24", "198.51.100.0/24"]}},
+		{"name": "AzureCloud.westeurope", "properties": {"region": "westeurope", "addressPrefixes": ["192.0.2.0/24"]}},
+		{"name": "AzureFrontDoor.Frontend.WestEurope", "properties": {"region": "westeurope", "addressPrefixes": ["192.0.2.0/24"]}}
+	]}`,
+	"/oracle": `{"regions": [
+		{"region": "us-phoenix-1", "cidrs": [{"cidr": "192.0.2.0/24", "tags": ["OCI"]}, {"cidr": "198.51.100.0/24", "tags": []}]}
+	]}`,
+}
+
+func newFeedServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := testFeeds[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFeedRanges(t *testing.T) {
+	server := newFeedServer(t)
+
+	for format, expected := range map[string]map[string][]string{
+		"aws": {
+			"aws/ec2/us-east-1": {"192.0.2.0/24"},
+			"aws/cloudfront":    {"198.51.100.0/24"},
+			"aws/s3/eu-west-1":  {"2001:db8::/32"},
+		},
+		"gcp": {
+			"gcp/google-cloud/us-east1":     {"192.0.2.0/24"},
+			"gcp/google-cloud/europe-west1": {"2001:db8::/32"},
+		},
+		"azure": {
+			"azure/AzureFrontDoor.Frontend/westeurope": {"192.0.2.0/24"},
+			"azure/AzureCloud":                         {"198.51.100.0/24"},
+		},
+		"oracle": {
+			"oracle/oci/us-phoenix-1": {"192.0.2.0/24"},
+			"oracle/us-phoenix-1":     {"198.51.100.0/24"},
+		},
+	} {
+		ranges, err := getFeedRanges(server.Client(), format, &Feed{Format: format, URL: server.URL + "/" + format})
+		require.Nil(t, err, "could not get %s feed", format)
+		require.Equal(t, expected, ranges, "could not get ranges of %s feed", format)
+	}
+
+	_, err := getFeedRanges(server.Client(), "aws", &Feed{Format: "unknown", URL: server.URL + "/aws"})
+	require.NotNil(t, err, "could get feed of unknown format")
+	_, err = getFeedRanges(server.Client(), "aws", &Feed{Format: "gcp", URL: server.URL + "/aws"})
+	require.NotNil(t, err, "could get feed without ranges")
+}
+
+func TestCompileFeeds(t *testing.T) {
+	server := newFeedServer(t)
+
+	categories := &Categories{Cloud: &Category{Feeds: map[string][]*Feed{
+		"aws": {{Format: "aws", URL: server.URL + "/aws"}},
+	}}}
+	compiled, err := categories.Compile(&Options{SkipScrapers: true})
+	require.Nil(t, err, "could not compile feeds")
+	require.Equal(t, []string{"198.51.100.0/24"}, compiled.Cloud["aws/cloudfront"], "could not get feed ranges")
+	require.Len(t, compiled.Metadata.Providers, 1, "could not group paths in metadata")
+	require.Equal(t, 3, compiled.Metadata.Providers[0].Prefixes, "could not count prefixes of paths")
+	require.Equal(t, cdncheck.SourceTypeFeed, compiled.Metadata.Providers[0].Sources[0].Type, "could not get feed source")
+
+	_, err = categories.Compile(&Options{Offline: true})
+	require.NotNil(t, err, "could compile feeds offline")
+
+	categories.Cloud.Feeds["aws"][0].Format = "unknown"
+	_, err = categories.Compile(&Options{SkipScrapers: true})
+	require.NotNil(t, err, "could compile feed of unknown format")
+}
+
+func TestCompileFeedsSamePath(t *testing.T) {
+	server := newFeedServer(t)
+
+	categories := &Categories{Cloud: &Category{Feeds: map[string][]*Feed{
+		"aws": {{Format: "aws", URL: server.URL + "/aws"}, {Format: "aws", URL: server.URL + "/aws-global"}},
+	}}}
+	compiled, err := categories.Compile(&Options{SkipScrapers: true})
+	require.Nil(t, err, "could not compile feeds")
+	require.Equal(t, []string{"198.51.100.0/24", "203.0.113.0/24"}, compiled.Cloud["aws/cloudfront"], "could not merge ranges of feeds with the same path")
+	require.Equal(t, []string{"192.0.2.0/24"}, compiled.Cloud["aws/ec2/us-east-1"], "could not keep ranges of other paths")
+}
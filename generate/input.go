@@ -6,14 +6,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"net/netip"
+	"os"
 	"regexp"
+	"slices"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/ipinfo/go/v2/ipinfo"
 	"github.com/projectdiscovery/cdncheck"
 	stringsutil "github.com/projectdiscovery/utils/strings"
+	"gopkg.in/yaml.v3"
 )
 
 var cidrRegex = regexp.MustCompile(`(([0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\/[0-9]{1,3})|(((([0-9A-Fa-f]{1,4}:){7}([0-9A-Fa-f]{1,4}|:))|(([0-9A-Fa-f]{1,4}:){6}(:[0-9A-Fa-f]{1,4}|((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3})|:))|(([0-9A-Fa-f]{1,4}:){5}(((:[0-9A-Fa-f]{1,4}){1,2})|:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3})|:))|(([0-9A-Fa-f]{1,4}:){4}(((:[0-9A-Fa-f]{1,4}){1,3})|((:[0-9A-Fa-f]{1,4})?:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){3}(((:[0-9A-Fa-f]{1,4}){1,4})|((:[0-9A-Fa-f]{1,4}){0,2}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){2}(((:[0-9A-Fa-f]{1,4}){1,5})|((:[0-9A-Fa-f]{1,4}){0,3}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){1}(((:[0-9A-Fa-f]{1,4}){1,6})|((:[0-9A-Fa-f]{1,4}){0,4}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:))|(:(((:[0-9A-Fa-f]{1,4}){1,7})|((:[0-9A-Fa-f]{1,4}){0,5}:((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(\.(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}))|:)))(%.+)?\/[0-9]{1,3}))`)
@@ -33,63 +38,435 @@ func getValidateCidrs(cidrs []string) []string {
 	return output
 }
 
+// ParseCategoriesFromFile parses the input structure from a provider.yaml file
+func ParseCategoriesFromFile(path string) (*Categories, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s file: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	categories := &Categories{}
+	if err := yaml.NewDecoder(file).Decode(categories); err != nil {
+		return nil, fmt.Errorf("could not decode %s file: %w", path, err)
+	}
+	return categories, nil
+}
+
 // Compile returns the compiled form of an input structure
 func (c *Categories) Compile(options *Options) (*cdncheck.InputCompiled, error) {
+	if options.Offline {
+		if err := c.validateOffline(); err != nil {
+			return nil, err
+		}
+	}
+	names, err := c.validateCategories()
+	if err != nil {
+		return nil, err
+	}
 	compiled := &cdncheck.InputCompiled{
-		CDN:    make(map[string][]string),
-		WAF:    make(map[string][]string),
-		Cloud:  make(map[string][]string),
-		Common: make(map[string][]string),
+		Categories:       c.Categories,
+		Common:           make(map[string][]string),
+		CommonCategories: make(map[string][]string),
 	}
+	sources := make(provenance)
 	// Fetch input items specified
-	if c.CDN != nil {
-		if err := c.CDN.fetchInputItem(options, compiled.CDN); err != nil {
-			log.Printf("[err] could not fetch cdn item: %s\n", err)
+	for _, name := range names {
+		data := make(map[string][]string)
+		if category := c.category(name); category != nil {
+			if err := category.fetchInputItem(options, data, sources.category(name)); err != nil {
+				log.Printf("[err] could not fetch %s item: %s\n", name, err)
+			}
 		}
+		compiled.SetCategoryRanges(name, data)
 	}
-	if c.WAF != nil {
-		if err := c.WAF.fetchInputItem(options, compiled.WAF); err != nil {
-			log.Printf("[err] could not fetch waf item: %s\n", err)
+	if c.Common != nil {
+		for provider, set := range c.Common.FQDN {
+			if set == nil {
+				continue
+			}
+			for _, category := range set.Categories {
+				if !slices.Contains(names, category) {
+					return nil, fmt.Errorf("invalid category %s specified for fqdn of %s", category, provider)
+				}
+			}
+			compiled.Common[provider] = set.Suffixes
+			if len(set.Categories) > 0 {
+				compiled.CommonCategories[provider] = set.Categories
+			}
 		}
+		if err := c.Common.compileFingerprints(compiled, names); err != nil {
+			return nil, err
+		}
+		if err := c.Common.compileBlockFingerprints(compiled, names); err != nil {
+			return nil, err
+		}
+		if err := c.Common.compileTLSIssuers(compiled, names); err != nil {
+			return nil, err
+		}
+		if err := c.Common.compileNameservers(compiled, names); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fetch custom scraper data and merge
+	if !options.Offline && !options.SkipScrapers {
+		runScrapers(compiled, sources)
+	}
+	registry, err := c.compileRegistry(compiled, names)
+	if err != nil {
+		return nil, err
 	}
-	if c.Cloud != nil {
-		if err := c.Cloud.fetchInputItem(options, compiled.Cloud); err != nil {
-			log.Printf("[err] could not fetch cloud item: %s\n", err)
+	compiled.Registry = registry
+	compiled.Metadata = sources.metadata(options, compiled)
+	return compiled, nil
+}
+
+// compileFingerprints validates the http fingerprints and sets them to
+// the compiled data
+func (c *Category) compileFingerprints(compiled *cdncheck.InputCompiled, names []string) error {
+	for provider, set := range c.HTTP {
+		if set == nil {
+			continue
+		}
+		if len(set.Categories) == 0 {
+			return fmt.Errorf("no category specified for http fingerprints of %s", provider)
+		}
+		for _, category := range set.Categories {
+			if !slices.Contains(names, category) {
+				return fmt.Errorf("invalid category %s specified for http fingerprints of %s", category, provider)
+			}
+		}
+		for _, fingerprint := range set.Fingerprints {
+			if err := fingerprint.Validate(); err != nil {
+				return fmt.Errorf("invalid http fingerprint of %s: %w", provider, err)
+			}
 		}
+		if compiled.Fingerprints == nil {
+			compiled.Fingerprints = make(map[string][]cdncheck.HTTPFingerprint)
+			compiled.FingerprintCategories = make(map[string][]string)
+		}
+		compiled.Fingerprints[provider] = set.Fingerprints
+		compiled.FingerprintCategories[provider] = set.Categories
 	}
-	if c.Common != nil {
-		compiled.Common = c.Common.FQDN
+	return nil
+}
+
+// compileTLSIssuers validates the certificate issuers and sets them to
+// the compiled data
+func (c *Category) compileTLSIssuers(compiled *cdncheck.InputCompiled, names []string) error {
+	for provider, set := range c.TLS {
+		if set == nil {
+			continue
+		}
+		if len(set.Categories) == 0 {
+			return fmt.Errorf("no category specified for tls issuers of %s", provider)
+		}
+		for _, category := range set.Categories {
+			if !slices.Contains(names, category) {
+				return fmt.Errorf("invalid category %s specified for tls issuers of %s", category, provider)
+			}
+		}
+		for _, issuer := range set.Issuers {
+			if _, err := regexp.Compile(issuer); err != nil {
+				return fmt.Errorf("invalid tls issuer %q of %s: %w", issuer, provider, err)
+			}
+		}
+		if compiled.TLSIssuers == nil {
+			compiled.TLSIssuers = make(map[string][]string)
+			compiled.TLSCategories = make(map[string][]string)
+		}
+		compiled.TLSIssuers[provider] = set.Issuers
+		compiled.TLSCategories[provider] = set.Categories
 	}
+	return nil
+}
 
-	// Fetch custom scraper data and merge
+// compileNameservers validates the nameserver patterns and sets them to
+// the compiled data, providers declaring no category being dns providers
+func (c *Category) compileNameservers(compiled *cdncheck.InputCompiled, names []string) error {
+	for provider, set := range c.NS {
+		if set == nil {
+			continue
+		}
+		categories := set.Categories
+		if len(categories) == 0 {
+			categories = []string{"dns"}
+		}
+		for _, category := range categories {
+			if !slices.Contains(names, category) {
+				return fmt.Errorf("invalid category %s specified for nameservers of %s", category, provider)
+			}
+		}
+		for _, pattern := range set.Suffixes {
+			if err := cdncheck.ValidateNameserverPattern(pattern); err != nil {
+				return fmt.Errorf("invalid nameserver of %s: %w", provider, err)
+			}
+		}
+		if compiled.Nameservers == nil {
+			compiled.Nameservers = make(map[string][]string)
+			compiled.NameserverCategories = make(map[string][]string)
+		}
+		compiled.Nameservers[provider] = set.Suffixes
+		if len(set.Categories) > 0 {
+			compiled.NameserverCategories[provider] = set.Categories
+		}
+	}
+	return nil
+}
+
+// compileBlockFingerprints validates the block page fingerprints and sets
+// them to the compiled data, the providers having them being wafs
+func (c *Category) compileBlockFingerprints(compiled *cdncheck.InputCompiled, names []string) error {
+	if len(c.Block) == 0 {
+		return nil
+	}
+	if !slices.Contains(names, "waf") {
+		return errors.New("block fingerprints specified without waf category")
+	}
+	for provider, fingerprints := range c.Block {
+		if len(fingerprints) == 0 {
+			return fmt.Errorf("no block fingerprints specified for %s", provider)
+		}
+		for _, fingerprint := range fingerprints {
+			if err := fingerprint.Validate(); err != nil {
+				return fmt.Errorf("invalid block fingerprint of %s: %w", provider, err)
+			}
+		}
+		if compiled.BlockFingerprints == nil {
+			compiled.BlockFingerprints = make(map[string][]cdncheck.HTTPFingerprint)
+		}
+		compiled.BlockFingerprints[provider] = fingerprints
+	}
+	return nil
+}
+
+var providerIDRegex = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// validateCategories validates the declared categories and returns
+// their names in check order
+func (c *Categories) validateCategories() ([]string, error) {
+	names := c.names()
+	for index, name := range names {
+		if !providerIDRegex.MatchString(name) || name == "categories" || name == "common" || name == "providers" {
+			return nil, fmt.Errorf("invalid category name %q specified", name)
+		}
+		if slices.Contains(names[:index], name) {
+			return nil, fmt.Errorf("category %s is declared more than once", name)
+		}
+	}
+	for _, name := range []string{"cdn", "waf", "cloud"} {
+		if c.category(name) != nil && !slices.Contains(names, name) {
+			return nil, fmt.Errorf("section %s is not a declared category", name)
+		}
+	}
+	for _, name := range names {
+		category := c.category(name)
+		if category == nil {
+			continue
+		}
+		for provider, feeds := range category.Feeds {
+			for _, feed := range feeds {
+				if _, ok := feedParsers[feed.Format]; !ok {
+					return nil, fmt.Errorf("invalid feed format %q specified for %s", feed.Format, provider)
+				}
+			}
+		}
+	}
+	return names, nil
+}
+
+// compileRegistry validates the registry entries and returns them sorted
+// by id, each with the categories its names appear in within the data
+func (c *Categories) compileRegistry(compiled *cdncheck.InputCompiled, names []string) ([]cdncheck.ProviderInfo, error) {
+	ids := make(map[string]string)
+	for id := range c.Providers {
+		if !providerIDRegex.MatchString(id) {
+			return nil, fmt.Errorf("invalid provider id %q specified", id)
+		}
+		ids[id] = id
+	}
+	for _, id := range slices.Sorted(maps.Keys(c.Providers)) {
+		provider := c.Providers[id]
+		if provider == nil {
+			continue
+		}
+		if provider.Parent != "" && c.Providers[provider.Parent] == nil {
+			return nil, fmt.Errorf("unknown parent %s specified for provider %s", provider.Parent, id)
+		}
+		for _, category := range provider.Categories {
+			if !slices.Contains(names, category) {
+				return nil, fmt.Errorf("invalid category %s specified for provider %s", category, id)
+			}
+		}
+		for _, tag := range provider.Tags {
+			if !providerIDRegex.MatchString(tag) {
+				return nil, fmt.Errorf("invalid tag %q specified for provider %s", tag, id)
+			}
+		}
+		for _, alias := range provider.Aliases {
+			if other, ok := ids[alias]; ok && other != id {
+				return nil, fmt.Errorf("alias %s of provider %s is already used by %s", alias, id, other)
+			}
+			ids[alias] = id
+		}
+	}
+
+	categories := make(map[string][]string)
+	for _, category := range names {
+		for name := range compiled.CategoryRanges(category) {
+			provider, _ := cdncheck.SplitProviderPath(name)
+			categories[ids[provider]] = append(categories[ids[provider]], category)
+		}
+	}
+	for name, declared := range compiled.CommonCategories {
+		categories[ids[name]] = append(categories[ids[name]], declared...)
+	}
+	for name, declared := range compiled.FingerprintCategories {
+		categories[ids[name]] = append(categories[ids[name]], declared...)
+	}
+	for name, declared := range compiled.TLSCategories {
+		categories[ids[name]] = append(categories[ids[name]], declared...)
+	}
+	for name := range compiled.Nameservers {
+		declared := compiled.NameserverCategories[name]
+		if len(declared) == 0 {
+			declared = []string{"dns"}
+		}
+		categories[ids[name]] = append(categories[ids[name]], declared...)
+	}
+	for name := range compiled.BlockFingerprints {
+		categories[ids[name]] = append(categories[ids[name]], "waf")
+	}
+
+	registry := make([]cdncheck.ProviderInfo, 0, len(c.Providers))
+	for _, id := range slices.Sorted(maps.Keys(c.Providers)) {
+		provider := cdncheck.ProviderInfo{ID: id}
+		if c.Providers[id] != nil {
+			provider = *c.Providers[id]
+			provider.ID = id
+		}
+		provider.Categories = slices.DeleteFunc(slices.Clone(names), func(category string) bool {
+			return !slices.Contains(provider.Categories, category) && !slices.Contains(categories[id], category)
+		})
+		registry = append(registry, provider)
+	}
+	return registry, nil
+}
+
+// runScrapers merges the ranges fetched by the custom scrapers
+func runScrapers(compiled *cdncheck.InputCompiled, sources provenance) {
 	for dataType, scraper := range scraperTypeToScraperMap {
-		var data map[string][]string
-
-		switch dataType {
-		case "cdn":
-			data = compiled.CDN
-		case "waf":
-			data = compiled.WAF
-		case "cloud":
-			data = compiled.Cloud
-		default:
-			panic(fmt.Sprintf("invalid datatype %s specified", dataType))
+		// scrapers of categories which are not declared are skipped
+		data := compiled.CategoryRanges(dataType)
+		if data == nil {
+			continue
 		}
 		for _, item := range scraper {
 			if response, err := item.scraper(http.DefaultClient); err != nil {
 				log.Printf("[err] could not scrape %s item: %s\n", item.name, err)
 			} else {
 				data[item.name] = response
+				sources.category(dataType).add(item.name, cdncheck.SourceTypeScraper, item.name, len(response))
 			}
 		}
 	}
-	return compiled, nil
+}
+
+// provenance records the sources of the ranges of each provider
+// of each category while compiling
+type provenance map[string]categoryProvenance
+
+// categoryProvenance records the sources of the providers of a category
+type categoryProvenance map[string][]cdncheck.SourceMetadata
+
+// category returns the sources of the providers of a category
+func (p provenance) category(category string) categoryProvenance {
+	if p[category] == nil {
+		p[category] = make(categoryProvenance)
+	}
+	return p[category]
+}
+
+// add records a source of a provider
+func (p categoryProvenance) add(provider string, sourceType cdncheck.SourceType, source string, prefixes int) {
+	item := cdncheck.SourceMetadata{Type: sourceType, Source: source, Prefixes: prefixes}
+	if sourceType != cdncheck.SourceTypeCIDR {
+		item.FetchedAt = time.Now().UTC()
+	}
+	p[provider] = append(p[provider], item)
+}
+
+// metadata returns the metadata of the compiled data
+func (p provenance) metadata(options *Options, compiled *cdncheck.InputCompiled) *cdncheck.Metadata {
+	metadata := &cdncheck.Metadata{
+		GeneratedAt: time.Now().UTC(),
+		Version:     options.Version,
+	}
+	for _, category := range compiled.CategoryNames() {
+		// the services and regions of a provider are counted along with it
+		prefixes := make(map[string]int)
+		for name, cidrs := range compiled.CategoryRanges(category) {
+			provider, _ := cdncheck.SplitProviderPath(name)
+			prefixes[provider] += len(cidrs)
+		}
+		for provider, count := range prefixes {
+			metadata.Providers = append(metadata.Providers, cdncheck.ProviderMetadata{
+				Category: category,
+				Provider: provider,
+				Prefixes: count,
+				Sources:  p[category][provider],
+			})
+		}
+	}
+	metadata.SortProviders()
+	return metadata
+}
+
+// validateOffline returns an error if any category has entries
+// which need to be fetched
+func (c *Categories) validateOffline() error {
+	categories := map[string]*Category{"cdn": c.CDN, "waf": c.WAF, "cloud": c.Cloud, "common": c.Common}
+	maps.Copy(categories, c.Ranges)
+	for name, category := range categories {
+		if category == nil {
+			continue
+		}
+		if len(category.URLs) > 0 {
+			return fmt.Errorf("url entries of %s are not allowed in offline mode", name)
+		}
+		if len(category.ASN) > 0 {
+			return fmt.Errorf("asn entries of %s are not allowed in offline mode", name)
+		}
+		if len(category.Feeds) > 0 {
+			return fmt.Errorf("feed entries of %s are not allowed in offline mode", name)
+		}
+	}
+	return nil
 }
 
 // fetchInputItem fetches input items and writes data to map
-func (c *Category) fetchInputItem(options *Options, data map[string][]string) error {
+func (c *Category) fetchInputItem(options *Options, data map[string][]string, sources categoryProvenance) error {
 	for provider, cidrs := range c.CIDR {
 		data[provider] = cidrs
+		sources.add(provider, cdncheck.SourceTypeCIDR, "", len(cidrs))
+	}
+	for provider, feeds := range c.Feeds {
+		for _, feed := range feeds {
+			ranges, err := getFeedRanges(http.DefaultClient, provider, feed)
+			if err != nil {
+				return fmt.Errorf("could not get feed %s: %s", feed.URL, err)
+			}
+			var prefixes int
+			// feeds of a provider may resolve to the same service and region
+			for path, cidrs := range ranges {
+				data[path] = appendUnique(data[path], cidrs...)
+				prefixes += len(cidrs)
+			}
+			sources.add(provider, cdncheck.SourceTypeFeed, feed.URL, prefixes)
+		}
 	}
 	for provider, urls := range c.URLs {
 		for _, item := range urls {
@@ -97,6 +474,7 @@ func (c *Category) fetchInputItem(options *Options, data map[string][]string) er
 				return fmt.Errorf("could not get url %s: %s", item, err)
 			} else {
 				data[provider] = cidrs
+				sources.add(provider, cdncheck.SourceTypeURL, item, len(cidrs))
 			}
 		}
 	}
@@ -110,6 +488,7 @@ func (c *Category) fetchInputItem(options *Options, data map[string][]string) er
 				return fmt.Errorf("could not get asn %s: %s", item, err)
 			} else {
 				data[provider] = cidrs
+				sources.add(provider, cdncheck.SourceTypeASN, item, len(cidrs))
 			}
 		}
 	}
@@ -118,6 +497,22 @@ func (c *Category) fetchInputItem(options *Options, data map[string][]string) er
 
 var errNoCidrFound = errors.New("no cidrs found for url")
 
+// appendUnique appends the items missing from values in order
+func appendUnique(values []string, items ...string) []string {
+	seen := make(map[string]struct{}, len(values)+len(items))
+	for _, value := range values {
+		seen[value] = struct{}{}
+	}
+	for _, item := range items {
+		if _, ok := seen[item]; ok {
+			continue
+		}
+		seen[item] = struct{}{}
+		values = append(values, item)
+	}
+	return values
+}
+
 // getIpInfoASN returns cidrs for an ASN from ipinfo using a token
 func getIpInfoASN(httpClient *http.Client, token string, asn string) ([]string, error) {
 	if token == "" {
@@ -143,6 +538,22 @@ func getIpInfoASN(httpClient *http.Client, token string, asn string) ([]string,
 
 // getCIDRFromURL scrapes CIDR ranges for a URL using a regex
 func getCIDRFromURL(URL string) ([]string, error) {
+	data, err := fetchURL(http.DefaultClient, URL)
+	if err != nil {
+		return nil, err
+	}
+
+	body := string(data)
+
+	cidrs := cidrRegex.FindAllString(body, -1)
+	if len(cidrs) == 0 {
+		return nil, errNoCidrFound
+	}
+	return getValidateCidrs(cidrs), nil
+}
+
+// fetchURL returns the body of a URL
+func fetchURL(httpClient *http.Client, URL string) ([]byte, error) {
 	retried := false
 retry:
 	req, err := http.NewRequest(http.MethodGet, URL, nil)
@@ -150,7 +561,7 @@ retry:
 		return nil, err
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/143.0.0.0 Safari/537.36 Edg/143.0.0.0")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -180,12 +591,5 @@ retry:
 		retried = true
 		goto retry
 	}
-
-	body := string(data)
-
-	cidrs := cidrRegex.FindAllString(body, -1)
-	if len(cidrs) == 0 {
-		return nil, errNoCidrFound
-	}
-	return getValidateCidrs(cidrs), nil
+	return data, nil
 }
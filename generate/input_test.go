@@ -0,0 +1,249 @@
+package generate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/projectdiscovery/cdncheck"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileOffline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provider.yaml")
+	err := os.WriteFile(path, []byte(`
+cdn:
+  cidr:
+    internal-edge:
+      - "10.10.0.0/16"
+common:
+  fqdn:
+    internal-edge:
+      categories: [cdn]
+      suffixes:
+        - edge.internal.example
+    legacy:
+      - legacy.example
+`), 0o600)
+	require.Nil(t, err, "could not write provider file")
+
+	categories, err := ParseCategoriesFromFile(path)
+	require.Nil(t, err, "could not parse provider file")
+	compiled, err := categories.Compile(&Options{Offline: true})
+	require.Nil(t, err, "could not compile provider file")
+	require.Equal(t, []string{"10.10.0.0/16"}, compiled.CDN["internal-edge"], "could not get static cidrs")
+	require.Equal(t, []string{"edge.internal.example"}, compiled.Common["internal-edge"], "could not get suffixes")
+	require.Equal(t, []string{"cdn"}, compiled.CommonCategories["internal-edge"], "could not get suffix categories")
+	require.Equal(t, []string{"legacy.example"}, compiled.Common["legacy"], "could not get list of suffixes")
+	require.Empty(t, compiled.WAF, "could run scrapers offline")
+	require.NotNil(t, compiled.Metadata, "could not get metadata")
+	require.False(t, compiled.Metadata.GeneratedAt.IsZero(), "could not get generation time")
+	require.Equal(t, []cdncheck.ProviderMetadata{{
+		Category: "cdn",
+		Provider: "internal-edge",
+		Prefixes: 1,
+		Sources:  []cdncheck.SourceMetadata{{Type: cdncheck.SourceTypeCIDR, Prefixes: 1}},
+	}}, compiled.Metadata.Providers, "could not get provider metadata")
+
+	categories.WAF = &Category{URLs: map[string][]string{"remote": {"https://example.com/ranges.txt"}}}
+	_, err = categories.Compile(&Options{Offline: true})
+	require.NotNil(t, err, "could compile url entries offline")
+
+	categories.WAF = nil
+	categories.Common.FQDN["invalid"] = &FQDNSet{Categories: []string{"dns"}, Suffixes: []string{"invalid.example"}}
+	_, err = categories.Compile(&Options{Offline: true})
+	require.NotNil(t, err, "could compile invalid suffix category")
+}
+
+func TestCompileRegistry(t *testing.T) {
+	categories := &Categories{
+		CDN: &Category{CIDR: map[string][]string{"腾讯云": {"192.0.2.0/24"}}},
+		Common: &Category{FQDN: map[string]*FQDNSet{
+			"tencent-cloud": {Categories: []string{"cloud"}, Suffixes: []string{"tencent.example"}},
+		}},
+		Providers: map[string]*cdncheck.ProviderInfo{
+			"tencent": {Name: "Tencent", Categories: []string{"waf"}},
+			"tencent-cloud": {
+				Name:    "Tencent Cloud",
+				Names:   map[string]string{"zh": "腾讯云"},
+				Aliases: []string{"腾讯云"},
+				Parent:  "tencent",
+			},
+		},
+	}
+	compiled, err := categories.Compile(&Options{Offline: true})
+	require.Nil(t, err, "could not compile registry")
+	require.Equal(t, []cdncheck.ProviderInfo{
+		{ID: "tencent", Name: "Tencent", Categories: []string{"waf"}},
+		{
+			ID:         "tencent-cloud",
+			Name:       "Tencent Cloud",
+			Names:      map[string]string{"zh": "腾讯云"},
+			Aliases:    []string{"腾讯云"},
+			Parent:     "tencent",
+			Categories: []string{"cdn", "cloud"},
+		},
+	}, compiled.Registry, "could not get registry")
+
+	for name, provider := range map[string]*cdncheck.ProviderInfo{
+		"Invalid ID": {},
+		"orphan":     {Parent: "unknown"},
+		"duplicate":  {Aliases: []string{"腾讯云"}},
+		"category":   {Categories: []string{"unknown"}},
+	} {
+		categories.Providers[name] = provider
+		_, err = categories.Compile(&Options{Offline: true})
+		require.NotNil(t, err, "could compile invalid provider %s", name)
+		delete(categories.Providers, name)
+	}
+}
+
+func TestCompileCategories(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provider.yaml")
+	err := os.WriteFile(path, []byte(`
+categories:
+  - name: cdn
+  - name: hosting
+    description: Hosting providers
+hosting:
+  cidr:
+    racks:
+      - "198.51.100.0/24"
+common:
+  fqdn:
+    racks:
+      categories: [hosting]
+      suffixes:
+        - racks.example
+providers:
+  racks:
+    name: Racks
+    tags: [hosting, dns]
+`), 0o600)
+	require.Nil(t, err, "could not write provider file")
+
+	categories, err := ParseCategoriesFromFile(path)
+	require.Nil(t, err, "could not parse provider file")
+	compiled, err := categories.Compile(&Options{Offline: true})
+	require.Nil(t, err, "could not compile provider file")
+	require.Equal(t, []string{"198.51.100.0/24"}, compiled.CategoryRanges("hosting")["racks"], "could not get ranges of declared category")
+	require.Nil(t, compiled.WAF, "could compile undeclared category")
+	require.Equal(t, []string{"cdn", "hosting"}, compiled.CategoryNames(), "could not get category names")
+	require.Equal(t, []string{"hosting"}, compiled.Registry[0].Categories, "could not get registry categories")
+	require.Equal(t, []string{"hosting", "dns"}, compiled.Registry[0].Tags, "could not get registry tags")
+	require.Equal(t, "hosting", compiled.Metadata.Providers[0].Category, "could not get metadata of declared category")
+
+	err = os.WriteFile(path, []byte("categories:\n  - name: cdn\nhosting:\n  cidr: {}\n"), 0o600)
+	require.Nil(t, err, "could not write provider file")
+	_, err = ParseCategoriesFromFile(path)
+	require.NotNil(t, err, "could parse undeclared category section")
+
+	categories.WAF = &Category{}
+	_, err = categories.Compile(&Options{Offline: true})
+	require.NotNil(t, err, "could compile undeclared builtin category")
+}
+
+func TestCompileFingerprints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provider.yaml")
+	err := os.WriteFile(path, []byte(`
+common:
+  http:
+    edge:
+      categories: [cdn, waf]
+      fingerprints:
+        - header: x-edge-id
+        - header: server
+          value: ^EdgeServer
+        - cookie: edge_
+          status: [403]
+  block:
+    edge:
+      - status: [403]
+        body: blocked by edge
+providers:
+  edge:
+    name: Edge
+`), 0o600)
+	require.Nil(t, err, "could not write provider file")
+
+	categories, err := ParseCategoriesFromFile(path)
+	require.Nil(t, err, "could not parse provider file")
+	compiled, err := categories.Compile(&Options{Offline: true})
+	require.Nil(t, err, "could not compile provider file")
+	require.Len(t, compiled.Fingerprints["edge"], 3, "could not get fingerprints")
+	require.Equal(t, []int{403}, compiled.Fingerprints["edge"][2].Status, "could not get fingerprint status")
+	require.Equal(t, []string{"cdn", "waf"}, compiled.FingerprintCategories["edge"], "could not get fingerprint categories")
+	require.Equal(t, []string{"cdn", "waf"}, compiled.Registry[0].Categories, "could not get registry categories")
+	require.Equal(t, "blocked by edge", compiled.BlockFingerprints["edge"][0].Body, "could not get block fingerprints")
+
+	invalid := []*HTTPSet{
+		{Categories: []string{"cdn"}, Fingerprints: []cdncheck.HTTPFingerprint{{Header: "server", Value: "("}}},
+		{Categories: []string{"cdn"}, Fingerprints: []cdncheck.HTTPFingerprint{{Value: "edge"}}},
+		{Fingerprints: []cdncheck.HTTPFingerprint{{Header: "x-edge-id"}}},
+		{Categories: []string{"dns"}, Fingerprints: []cdncheck.HTTPFingerprint{{Header: "x-edge-id"}}},
+	}
+	for _, set := range invalid {
+		categories.Common.HTTP["invalid"] = set
+		_, err = categories.Compile(&Options{Offline: true})
+		require.NotNil(t, err, "could compile invalid fingerprints %+v", set)
+	}
+	delete(categories.Common.HTTP, "invalid")
+
+	categories.Common.Block["invalid"] = []cdncheck.HTTPFingerprint{{Body: "[blocked"}}
+	_, err = categories.Compile(&Options{Offline: true})
+	require.NotNil(t, err, "could compile invalid block fingerprint")
+}
+
+func TestCompileTLSIssuers(t *testing.T) {
+	categories := &Categories{
+		Common: &Category{TLS: map[string]*TLSSet{
+			"edge": {Categories: []string{"cdn"}, Issuers: []string{"^Edge Issuing CA"}},
+		}},
+		Providers: map[string]*cdncheck.ProviderInfo{"edge": {Name: "Edge"}},
+	}
+	compiled, err := categories.Compile(&Options{Offline: true})
+	require.Nil(t, err, "could not compile tls issuers")
+	require.Equal(t, []string{"^Edge Issuing CA"}, compiled.TLSIssuers["edge"], "could not get tls issuers")
+	require.Equal(t, []string{"cdn"}, compiled.TLSCategories["edge"], "could not get tls categories")
+	require.Equal(t, []string{"cdn"}, compiled.Registry[0].Categories, "could not get registry categories")
+
+	for _, set := range []*TLSSet{
+		{Categories: []string{"cdn"}, Issuers: []string{"(Edge"}},
+		{Issuers: []string{"^Edge"}},
+		{Categories: []string{"dns"}, Issuers: []string{"^Edge"}},
+	} {
+		categories.Common.TLS["invalid"] = set
+		_, err = categories.Compile(&Options{Offline: true})
+		require.NotNil(t, err, "could compile invalid tls issuers %+v", set)
+	}
+}
+
+func TestCompileNameservers(t *testing.T) {
+	categories := &Categories{
+		Categories: []cdncheck.CategoryInfo{{Name: "dns"}},
+		Common: &Category{NS: map[string]*FQDNSet{
+			"edge": {Suffixes: []string{"ns.edge.net", "edgedns-*.com"}},
+		}},
+		Providers: map[string]*cdncheck.ProviderInfo{"edge": {Name: "Edge"}},
+	}
+	compiled, err := categories.Compile(&Options{Offline: true})
+	require.Nil(t, err, "could not compile nameservers")
+	require.Equal(t, []string{"ns.edge.net", "edgedns-*.com"}, compiled.Nameservers["edge"], "could not get nameservers")
+	require.Empty(t, compiled.NameserverCategories["edge"], "could not get default nameserver category")
+	require.Equal(t, []string{"dns"}, compiled.Registry[0].Categories, "could not get registry categories")
+
+	categories.Categories = nil
+	_, err = categories.Compile(&Options{Offline: true})
+	require.NotNil(t, err, "could compile nameservers without dns category")
+
+	categories.Categories = []cdncheck.CategoryInfo{{Name: "dns"}}
+	for _, set := range []*FQDNSet{
+		{Suffixes: []string{"edgedns-[.com"}},
+		{Suffixes: []string{"ns..edge.net"}},
+		{Categories: []string{"mail"}, Suffixes: []string{"ns.edge.net"}},
+	} {
+		categories.Common.NS["invalid"] = set
+		_, err = categories.Compile(&Options{Offline: true})
+		require.NotNil(t, err, "could compile invalid nameservers %+v", set)
+	}
+}
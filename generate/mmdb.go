@@ -0,0 +1,220 @@
+package generate
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/gaissmai/bart"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/projectdiscovery/cdncheck"
+)
+
+// MMDBDatabaseType is the database type of the mmdb exports of the data
+const MMDBDatabaseType = "cdncheck"
+
+// WriteMMDB writes the compiled data as a database in the MaxMind DB format,
+// so it can be used by tools reading such databases.
+//
+// Each network holds the provider the client reports for its ips, the
+// category being the first one in check order containing the network and
+// the provider the first one by name among the owners of its most specific
+// range in that category, as done by Client.Check. The record has the keys
+//
+//	category    category of the provider
+//	provider    provider, e.g. aws
+//	path        service and region of the provider, e.g. aws/ec2/us-east-1
+//	prefix      most specific range of the provider containing the network
+//	name        display name of the provider in the registry
+//	parent      id of the provider owning the provider in the registry
+//	tags        tags of the provider in the registry
+//	matches     every category and provider containing the network, each
+//	            with its category, provider, path and prefix
+//
+// along with autonomous_system_number and autonomous_system_organization
+// if the data has an ip to asn table, as in the GeoLite2 ASN databases.
+func WriteMMDB(writer io.Writer, data *cdncheck.InputCompiled) error {
+	options := mmdbwriter.Options{
+		DatabaseType: MMDBDatabaseType,
+		Description:  map[string]string{"en": "cdncheck provider data"},
+		// private ranges of custom providers are kept like any other
+		IncludeReservedNetworks: true,
+	}
+	if data.Metadata != nil && !data.Metadata.GeneratedAt.IsZero() {
+		options.BuildEpoch = data.Metadata.GeneratedAt.Unix()
+	}
+	tree, err := mmdbwriter.New(options)
+	if err != nil {
+		return fmt.Errorf("could not create mmdb tree: %w", err)
+	}
+
+	export := newMMDBExport(data)
+	// a network is inserted before the more specific ones it contains, which
+	// replace it for their part of the address space
+	networks := slices.SortedFunc(maps.Keys(export.networks), func(a, b netip.Prefix) int {
+		return cmp.Or(cmp.Compare(a.Bits(), b.Bits()), a.Addr().Compare(b.Addr()))
+	})
+	for _, network := range networks {
+		record := export.record(network)
+		if len(record) == 0 {
+			continue
+		}
+		ipNet := &net.IPNet{IP: network.Addr().AsSlice(), Mask: net.CIDRMask(network.Bits(), network.Addr().BitLen())}
+		if err := tree.Insert(ipNet, record); err != nil {
+			return fmt.Errorf("could not insert network %s: %w", network, err)
+		}
+	}
+	if _, err := tree.WriteTo(writer); err != nil {
+		return fmt.Errorf("could not write mmdb database: %w", err)
+	}
+	return nil
+}
+
+// mmdbCategory is the table of the ranges of a category, each range being
+// owned by the providers sorted by name
+type mmdbCategory struct {
+	name   string
+	ranger *bart.Table[[]string]
+}
+
+// mmdbExport holds the ranges of the data looked up for each network
+type mmdbExport struct {
+	categories []mmdbCategory
+	asn        *bart.Table[cdncheck.AutonomousSystem]
+	registry   []cdncheck.ProviderInfo
+	networks   map[netip.Prefix]struct{}
+}
+
+// newMMDBExport returns the tables of the ranges of the data
+func newMMDBExport(data *cdncheck.InputCompiled) *mmdbExport {
+	export := &mmdbExport{registry: data.Registry, networks: make(map[netip.Prefix]struct{})}
+	for _, category := range data.CategoryNames() {
+		ranges := data.CategoryRanges(category)
+		if len(ranges) == 0 {
+			continue
+		}
+		item := mmdbCategory{name: category, ranger: new(bart.Table[[]string])}
+		for _, provider := range slices.Sorted(maps.Keys(ranges)) {
+			for _, cidr := range ranges[provider] {
+				prefix, err := netip.ParsePrefix(cidr)
+				if err != nil {
+					continue
+				}
+				prefix = prefix.Masked()
+				export.networks[prefix] = struct{}{}
+				item.ranger.Modify(prefix, func(owners []string, _ bool) ([]string, bool) {
+					if len(owners) > 0 && owners[len(owners)-1] == provider {
+						return owners, false
+					}
+					return append(owners, provider), false
+				})
+			}
+		}
+		export.categories = append(export.categories, item)
+	}
+	if len(data.ASN) > 0 {
+		export.asn = new(bart.Table[cdncheck.AutonomousSystem])
+		for _, system := range data.ASN {
+			for _, cidr := range system.Prefixes {
+				prefix, err := netip.ParsePrefix(cidr)
+				if err != nil {
+					continue
+				}
+				prefix = prefix.Masked()
+				export.networks[prefix] = struct{}{}
+				// overlapping prefixes resolve to the lowest number
+				export.asn.Modify(prefix, func(existing cdncheck.AutonomousSystem, ok bool) (cdncheck.AutonomousSystem, bool) {
+					if ok && existing.Number < system.Number {
+						return existing, false
+					}
+					return system, false
+				})
+			}
+		}
+	}
+	return export
+}
+
+// record returns the record of a network. The ranges containing the
+// network are the same for all of its ips not in a more specific network.
+func (e *mmdbExport) record(network netip.Prefix) mmdbtype.Map {
+	record := mmdbtype.Map{}
+	var matches mmdbtype.Slice
+	for _, category := range e.categories {
+		seen := make(map[string]struct{})
+		var categoryMatches []mmdbtype.Map
+		// supernets are walked from the most to the least specific prefix
+		for prefix, owners := range category.ranger.Supernets(network) {
+			for _, owner := range owners {
+				provider, path := cdncheck.SplitProviderPath(owner)
+				if _, ok := seen[provider]; ok {
+					continue
+				}
+				seen[provider] = struct{}{}
+				match := mmdbtype.Map{
+					"category": mmdbtype.String(category.name),
+					"provider": mmdbtype.String(provider),
+					"prefix":   mmdbtype.String(prefix.String()),
+				}
+				if path != "" {
+					match["path"] = mmdbtype.String(owner)
+				}
+				if len(record) == 0 {
+					// the first owner of the most specific prefix of the first category
+					maps.Copy(record, match)
+					e.setProviderInfo(record, provider)
+				}
+				categoryMatches = append(categoryMatches, match)
+			}
+		}
+		slices.SortFunc(categoryMatches, func(a, b mmdbtype.Map) int {
+			return strings.Compare(string(a["provider"].(mmdbtype.String)), string(b["provider"].(mmdbtype.String)))
+		})
+		for _, match := range categoryMatches {
+			matches = append(matches, match)
+		}
+	}
+	if len(matches) > 0 {
+		record["matches"] = matches
+	}
+	if e.asn != nil {
+		if system, ok := e.asn.LookupPrefix(network); ok {
+			record["autonomous_system_number"] = mmdbtype.Uint32(system.Number)
+			if system.Org != "" {
+				record["autonomous_system_organization"] = mmdbtype.String(system.Org)
+			}
+		}
+	}
+	return record
+}
+
+// setProviderInfo sets the name, parent and tags of the provider in the
+// registry of the data to the record
+func (e *mmdbExport) setProviderInfo(record mmdbtype.Map, provider string) {
+	index := slices.IndexFunc(e.registry, func(info cdncheck.ProviderInfo) bool {
+		return strings.EqualFold(info.ID, provider) || slices.ContainsFunc(info.Aliases, func(alias string) bool {
+			return strings.EqualFold(alias, provider)
+		})
+	})
+	if index < 0 {
+		return
+	}
+	info := e.registry[index]
+	record["name"] = mmdbtype.String(info.DisplayName("en"))
+	if info.Parent != "" {
+		record["parent"] = mmdbtype.String(info.Parent)
+	}
+	if len(info.Tags) > 0 {
+		tags := make(mmdbtype.Slice, 0, len(info.Tags))
+		for _, tag := range info.Tags {
+			tags = append(tags, mmdbtype.String(tag))
+		}
+		record["tags"] = tags
+	}
+}
@@ -0,0 +1,140 @@
+package generate
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+	"github.com/projectdiscovery/cdncheck"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbTestRecord is the record of a network of an mmdb export
+type mmdbTestRecord struct {
+	Category string   `maxminddb:"category"`
+	Provider string   `maxminddb:"provider"`
+	Path     string   `maxminddb:"path"`
+	Prefix   string   `maxminddb:"prefix"`
+	Name     string   `maxminddb:"name"`
+	Tags     []string `maxminddb:"tags"`
+	Matches  []struct {
+		Category string `maxminddb:"category"`
+		Provider string `maxminddb:"provider"`
+		Path     string `maxminddb:"path"`
+		Prefix   string `maxminddb:"prefix"`
+	} `maxminddb:"matches"`
+	ASN uint32 `maxminddb:"autonomous_system_number"`
+}
+
+// requireMMDBRoundTrip checks the first and last address of every nth
+// network of the export of the data against the client
+func requireMMDBRoundTrip(t *testing.T, data *cdncheck.InputCompiled, every int) *maxminddb.Reader {
+	var buffer bytes.Buffer
+	require.Nil(t, WriteMMDB(&buffer, data), "could not write mmdb")
+	reader, err := maxminddb.OpenBytes(buffer.Bytes())
+	require.Nil(t, err, "could not open mmdb")
+	require.Equal(t, MMDBDatabaseType, reader.Metadata.DatabaseType, "could not get database type")
+
+	client, err := cdncheck.NewClient(cdncheck.WithData(data))
+	require.Nil(t, err, "could not create client")
+	count := 0
+	for result := range reader.Networks() {
+		if count++; (count-1)%every != 0 {
+			continue
+		}
+		var record mmdbTestRecord
+		require.Nil(t, result.Decode(&record), "could not decode record")
+		network := result.Prefix()
+		for _, addr := range []netip.Addr{network.Addr(), lastAddr(network)} {
+			ip := net.IP(addr.AsSlice())
+			matched, provider, category, err := client.Check(ip)
+			require.Nil(t, err, "could not check ip")
+			require.Equal(t, matched, record.Provider != "", "could not match %s as client", addr)
+			require.Equal(t, category, record.Category, "could not get category of %s", addr)
+			require.Equal(t, provider, record.Provider, "could not get provider of %s", addr)
+
+			checked, err := client.CheckResult(ip)
+			require.Nil(t, err, "could not check ip")
+			require.Equal(t, checked.Path, record.Path, "could not get path of %s", addr)
+			require.Equal(t, checked.Prefix, record.Prefix, "could not get prefix of %s", addr)
+			require.Equal(t, checked.ASN, record.ASN, "could not get asn of %s", addr)
+
+			matches, err := client.CheckAll(ip)
+			require.Nil(t, err, "could not check all")
+			require.Len(t, record.Matches, len(matches), "could not get matches of %s", addr)
+			for index, match := range matches {
+				require.Equal(t, match.Category, record.Matches[index].Category, "could not get match category of %s", addr)
+				require.Equal(t, match.Provider, record.Matches[index].Provider, "could not get match provider of %s", addr)
+				require.Equal(t, match.Path, record.Matches[index].Path, "could not get match path of %s", addr)
+				require.Equal(t, match.Prefix, record.Matches[index].Prefix, "could not get match prefix of %s", addr)
+			}
+		}
+	}
+	require.Greater(t, count, 0, "could not export networks")
+	return reader
+}
+
+func TestWriteMMDB(t *testing.T) {
+	data := &cdncheck.InputCompiled{
+		Categories: []cdncheck.CategoryInfo{{Name: "cdn"}, {Name: "waf"}, {Name: "cloud"}, {Name: "hosting"}},
+		CDN: map[string][]string{
+			"edge":   {"192.0.2.0/24", "2001:db8:1::/48"},
+			"fastly": {"192.0.2.0/26"},
+		},
+		WAF: map[string][]string{
+			"shield": {"192.0.2.0/25", "198.51.100.64/26"},
+		},
+		Cloud: map[string][]string{
+			"aws/ec2/us-east-1": {"198.51.100.0/24"},
+			"aws/s3":            {"198.51.100.128/25"},
+			"zcloud":            {"198.51.100.0/24", "2001:db8::/32"},
+			"private":           {"10.0.0.0/8"},
+		},
+		Ranges: map[string]map[string][]string{
+			"hosting": {"example-hosting": {"203.0.113.0/24", "198.51.100.0/23"}},
+		},
+		ASN: []cdncheck.AutonomousSystem{
+			{Number: 64500, Org: "Edge Networks", Prefixes: []string{"192.0.2.0/23"}},
+			{Number: 64501, Org: "Example Transit", Prefixes: []string{"192.0.2.128/25", "100.64.0.0/10"}},
+		},
+		Registry: []cdncheck.ProviderInfo{{ID: "edge", Name: "Edge CDN", Aliases: []string{"edge"}, Tags: []string{"cdn", "dns"}}},
+	}
+	reader := requireMMDBRoundTrip(t, data, 1)
+
+	var record mmdbTestRecord
+	require.Nil(t, reader.Lookup(netip.MustParseAddr("192.0.2.1")).Decode(&record), "could not lookup ip")
+	require.Equal(t, "fastly", record.Provider, "could not get most specific provider")
+	require.Len(t, record.Matches, 3, "could not merge providers of several categories")
+
+	require.Nil(t, reader.Lookup(netip.MustParseAddr("192.0.2.200")).Decode(&record), "could not lookup ip")
+	require.Equal(t, "Edge CDN", record.Name, "could not get registry name")
+	require.Equal(t, []string{"cdn", "dns"}, record.Tags, "could not get registry tags")
+	require.Equal(t, uint32(64501), record.ASN, "could not get most specific asn")
+
+	require.Nil(t, reader.Lookup(netip.MustParseAddr("198.51.100.200")).Decode(&record), "could not lookup ip")
+	require.Equal(t, "aws", record.Provider, "could not get provider of path")
+	require.Equal(t, "aws/s3", record.Path, "could not get path")
+
+	// the export is read back as an mmdb database of the client
+	var buffer bytes.Buffer
+	require.Nil(t, WriteMMDB(&buffer, data), "could not write mmdb")
+	path := t.TempDir() + "/sources_data.mmdb"
+	require.Nil(t, os.WriteFile(path, buffer.Bytes(), 0644), "could not write mmdb file")
+	client, err := cdncheck.NewClient(cdncheck.WithData(&cdncheck.InputCompiled{}), cdncheck.WithMMDB(path))
+	require.Nil(t, err, "could not create client")
+	info, ok := client.LookupASN(net.ParseIP("100.64.1.1"))
+	require.True(t, ok, "could not lookup asn of export")
+	require.Equal(t, "Example Transit", info.Org, "could not get asn org of export")
+}
+
+func TestWriteMMDBEmbedded(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping round trip of the embedded data in short mode")
+	}
+	data, err := cdncheck.NewEmbeddedSource().Load(t.Context())
+	require.Nil(t, err, "could not load embedded data")
+	requireMMDBRoundTrip(t, data, 50)
+}
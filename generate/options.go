@@ -8,6 +8,14 @@ import (
 type Options struct {
 	IPInfoToken string
 	HTTPClient  *http.Client
+	// Offline compiles static cidr and fqdn entries only, failing
+	// on url and asn entries which would need to be fetched
+	Offline bool
+	// SkipScrapers disables the built-in scrapers of well-known
+	// providers whose ranges are merged into the compiled data
+	SkipScrapers bool
+	// Version is the version of the tool recorded in the metadata
+	Version string
 }
 
 // HasAuthInfo returns true if auth info has been provided
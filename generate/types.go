@@ -1,7 +1,18 @@
 package generate
 
+import (
+	"fmt"
+	"slices"
+
+	"github.com/projectdiscovery/cdncheck"
+	"gopkg.in/yaml.v3"
+)
+
 // Categories contains various cdn, waf, cloud and fqdn operators
 type Categories struct {
+	// Categories contains the categories declared in check order, the
+	// default cdncheck.Categories being used if none is declared
+	Categories []cdncheck.CategoryInfo `yaml:"categories"`
 	// CDN contains a list of inputs for CDN cidrs
 	CDN *Category `yaml:"cdn"`
 	// WAF contains a list of inputs for WAF cidrs
@@ -9,6 +20,71 @@ type Categories struct {
 	// Cloud contains a list of inputs for Cloud cidrs
 	Cloud  *Category `yaml:"cloud"`
 	Common *Category `yaml:"common"`
+	// Providers contains the registry entries of the providers by id
+	Providers map[string]*cdncheck.ProviderInfo `yaml:"providers"`
+	// Ranges contains the inputs of the declared categories other
+	// than cdn, waf and cloud, given as top level sections
+	Ranges map[string]*Category `yaml:"-"`
+}
+
+// sections contains the top level sections which are not categories
+var sections = []string{"categories", "cdn", "waf", "cloud", "common", "providers"}
+
+// UnmarshalYAML decodes the inputs along with the sections of the
+// declared categories, returning an error for undeclared sections
+func (c *Categories) UnmarshalYAML(value *yaml.Node) error {
+	type plain Categories
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	if value.Kind != yaml.MappingNode {
+		return nil
+	}
+	names := c.names()
+	for index := 0; index+1 < len(value.Content); index += 2 {
+		key := value.Content[index].Value
+		if slices.Contains(sections, key) {
+			continue
+		}
+		if !slices.Contains(names, key) {
+			return fmt.Errorf("line %d: section %s is not a declared category", value.Content[index].Line, key)
+		}
+		category := &Category{}
+		if err := value.Content[index+1].Decode(category); err != nil {
+			return err
+		}
+		if c.Ranges == nil {
+			c.Ranges = make(map[string]*Category)
+		}
+		c.Ranges[key] = category
+	}
+	return nil
+}
+
+// names returns the names of the declared categories in check order,
+// or the default ones if none is declared
+func (c *Categories) names() []string {
+	if len(c.Categories) == 0 {
+		return slices.Clone(cdncheck.Categories)
+	}
+	names := make([]string, 0, len(c.Categories))
+	for _, category := range c.Categories {
+		names = append(names, category.Name)
+	}
+	return names
+}
+
+// category returns the inputs of a category
+func (c *Categories) category(name string) *Category {
+	switch name {
+	case "cdn":
+		return c.CDN
+	case "waf":
+		return c.WAF
+	case "cloud":
+		return c.Cloud
+	}
+	return c.Ranges[name]
 }
 
 // Category contains configuration for a specific category
@@ -23,5 +99,63 @@ type Category struct {
 	// used for checking the provided IP for each input type.
 	CIDR map[string][]string `yaml:"cidr"`
 	// FQDN contains public suffixes for major cloud operators
-	FQDN map[string][]string `yaml:"fqdn"`
+	FQDN map[string]*FQDNSet `yaml:"fqdn"`
+	// HTTP contains the http response fingerprints of providers
+	HTTP map[string]*HTTPSet `yaml:"http"`
+	// NS contains the nameserver patterns of dns providers, a label of a
+	// pattern possibly containing * wildcards, e.g. awsdns-*.com
+	NS map[string]*FQDNSet `yaml:"ns"`
+	// TLS contains the certificate issuers of providers
+	TLS map[string]*TLSSet `yaml:"tls"`
+	// Block contains the fingerprints of the block pages of wafs, which
+	// are matched against the responses of active waf probes
+	Block map[string][]cdncheck.HTTPFingerprint `yaml:"block"`
+	// Feeds contains structured feeds whose ranges are kept by service
+	// and region below their provider, e.g. aws/ec2/us-east-1
+	Feeds map[string][]*Feed `yaml:"feeds"`
+}
+
+// FQDNSet contains the public suffixes of an operator along with
+// the categories (cdn, waf, cloud) they are reported as
+type FQDNSet struct {
+	// Categories contains the categories of the suffixes, the first one
+	// being reported when a single category is expected
+	Categories []string `yaml:"categories"`
+	// Suffixes contains the public suffixes of the operator
+	Suffixes []string `yaml:"suffixes"`
+}
+
+// HTTPSet contains the http response fingerprints of a provider along
+// with the categories (cdn, waf, cloud) they are reported as
+type HTTPSet struct {
+	// Categories contains the categories of the fingerprints, the first
+	// one being reported when a single category is expected
+	Categories []string `yaml:"categories"`
+	// Fingerprints contains the fingerprints, any of them identifying
+	// the provider
+	Fingerprints []cdncheck.HTTPFingerprint `yaml:"fingerprints"`
+}
+
+// TLSSet contains the certificate issuers of a provider along with the
+// categories (cdn, waf, cloud) they are reported as
+type TLSSet struct {
+	// Categories contains the categories of the issuers, the first one
+	// being reported when a single category is expected
+	Categories []string `yaml:"categories"`
+	// Issuers contains case insensitive regular expressions matching the
+	// organization or common name of the issuers of the certificates
+	Issuers []string `yaml:"issuers"`
+}
+
+// UnmarshalYAML decodes a set either from a mapping or from a plain
+// list of suffixes without categories
+func (f *FQDNSet) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		return value.Decode(&f.Suffixes)
+	}
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: fqdn set must be a list or a mapping", value.Line)
+	}
+	type plain FQDNSet
+	return value.Decode((*plain)(f))
 }
@@ -0,0 +1,260 @@
+package cdncheck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HTTPFingerprint identifies a provider from an http response, all of the
+// conditions it has having to hold for the response
+type HTTPFingerprint struct {
+	// Header is the name of a header the response must have, e.g. cf-ray
+	Header string `yaml:"header,omitempty" json:"header,omitempty"`
+	// Value is a case insensitive regular expression a value of the
+	// header must match, e.g. ^AkamaiGHost
+	Value string `yaml:"value,omitempty" json:"value,omitempty"`
+	// Cookie is the prefix of the name of a cookie the response must set,
+	// e.g. incap_ses_
+	Cookie string `yaml:"cookie,omitempty" json:"cookie,omitempty"`
+	// Status contains the status codes the response must have one of
+	Status []int `yaml:"status,omitempty" json:"status,omitempty"`
+	// Body is a case insensitive regular expression the start of the
+	// response body must match, e.g. Attention Required! \| Cloudflare
+	Body string `yaml:"body,omitempty" json:"body,omitempty"`
+}
+
+// Validate returns an error if the fingerprint has no condition or an
+// invalid one
+func (f HTTPFingerprint) Validate() error {
+	if f.Header == "" && f.Cookie == "" && len(f.Status) == 0 && f.Body == "" {
+		return errors.New("fingerprint has no header, cookie, status or body")
+	}
+	if f.Value != "" {
+		if f.Header == "" {
+			return fmt.Errorf("fingerprint value %q has no header", f.Value)
+		}
+		if _, err := regexp.Compile(f.Value); err != nil {
+			return fmt.Errorf("invalid fingerprint value %q: %w", f.Value, err)
+		}
+	}
+	if f.Body != "" {
+		if _, err := regexp.Compile(f.Body); err != nil {
+			return fmt.Errorf("invalid fingerprint body %q: %w", f.Body, err)
+		}
+	}
+	for _, status := range f.Status {
+		if status < 100 || status > 999 {
+			return fmt.Errorf("invalid fingerprint status %d", status)
+		}
+	}
+	return nil
+}
+
+// String returns the conditions of the fingerprint, e.g. header:server=^AkamaiGHost
+func (f HTTPFingerprint) String() string {
+	var parts []string
+	if f.Header != "" {
+		header := "header:" + strings.ToLower(f.Header)
+		if f.Value != "" {
+			header += "=" + f.Value
+		}
+		parts = append(parts, header)
+	}
+	if f.Cookie != "" {
+		parts = append(parts, "cookie:"+f.Cookie)
+	}
+	if len(f.Status) > 0 {
+		codes := make([]string, 0, len(f.Status))
+		for _, status := range f.Status {
+			codes = append(codes, strconv.Itoa(status))
+		}
+		parts = append(parts, "status:"+strings.Join(codes, "|"))
+	}
+	if f.Body != "" {
+		parts = append(parts, "body:"+f.Body)
+	}
+	return strings.Join(parts, " ")
+}
+
+// httpFingerprint is a fingerprint with its value and body compiled
+type httpFingerprint struct {
+	HTTPFingerprint
+	value *regexp.Regexp
+	body  *regexp.Regexp
+}
+
+// maxFingerprintBody is the number of bytes of a response body read to
+// match the body of fingerprints
+const maxFingerprintBody = 64 * 1024
+
+// compileFingerprints returns the valid fingerprints with their
+// expressions compiled
+func compileFingerprints(fingerprints []HTTPFingerprint) []httpFingerprint {
+	var compiled []httpFingerprint
+	for _, fingerprint := range fingerprints {
+		if fingerprint.Validate() != nil {
+			continue
+		}
+		item := httpFingerprint{HTTPFingerprint: fingerprint}
+		if fingerprint.Value != "" {
+			item.value = regexp.MustCompile("(?i)" + fingerprint.Value)
+		}
+		if fingerprint.Body != "" {
+			item.body = regexp.MustCompile("(?i)" + fingerprint.Body)
+		}
+		compiled = append(compiled, item)
+	}
+	return compiled
+}
+
+// peekBody returns the start of the body of a response, which is put
+// back so the body can still be read by the caller
+func peekBody(response *http.Response) ([]byte, error) {
+	if response.Body == nil || response.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxFingerprintBody))
+	if err != nil {
+		return nil, fmt.Errorf("could not read response body: %w", err)
+	}
+	response.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), response.Body), response.Body}
+	return body, nil
+}
+
+// fingerprintMatch contains the fingerprints of a provider along with the
+// categories it is reported as
+type fingerprintMatch struct {
+	provider     string
+	categories   []string
+	fingerprints []httpFingerprint
+}
+
+// match returns true if all the conditions of the fingerprint hold for
+// the response with the start of its body
+func (f *httpFingerprint) match(response *http.Response, cookies []*http.Cookie, body []byte) bool {
+	if len(f.Status) > 0 && !slices.Contains(f.Status, response.StatusCode) {
+		return false
+	}
+	if f.Header != "" {
+		values := response.Header.Values(f.Header)
+		if len(values) == 0 {
+			return false
+		}
+		if f.value != nil && !slices.ContainsFunc(values, f.value.MatchString) {
+			return false
+		}
+	}
+	if f.Cookie != "" && !slices.ContainsFunc(cookies, func(cookie *http.Cookie) bool {
+		return strings.HasPrefix(cookie.Name, f.Cookie)
+	}) {
+		return false
+	}
+	if f.body != nil && !f.body.Match(body) {
+		return false
+	}
+	return true
+}
+
+// providerCategories returns the enabled categories a provider was
+// declared with, or the fallback if none, a replaced provider keeping
+// the other categories only
+func (o *clientOptions) providerCategories(provider string, declared []string, fallback string, providers map[string]map[string]*customProvider) []string {
+	if len(declared) == 0 {
+		declared = []string{fallback}
+	}
+	var categories []string
+	for _, category := range declared {
+		if custom, ok := providers[category][provider]; ok && custom.replace {
+			continue
+		}
+		if o.enabled(category) {
+			categories = appendUnique(categories, category)
+		}
+	}
+	return categories
+}
+
+// fingerprints returns the fingerprints of the data with their enabled
+// categories sorted by provider, skipping the invalid ones
+func (o *clientOptions) fingerprints(data *InputCompiled, providers map[string]map[string]*customProvider) []*fingerprintMatch {
+	var matches []*fingerprintMatch
+	for _, provider := range slices.Sorted(maps.Keys(data.Fingerprints)) {
+		// as for suffixes, sources declaring no category are wafs
+		categories := o.providerCategories(provider, data.FingerprintCategories[provider], defaultSuffixCategory, providers)
+		if len(categories) == 0 {
+			continue
+		}
+		matches = append(matches, &fingerprintMatch{
+			provider:     provider,
+			categories:   categories,
+			fingerprints: compileFingerprints(data.Fingerprints[provider]),
+		})
+	}
+	return matches
+}
+
+// matchFingerprints returns the first provider having a fingerprint
+// matching the response along with the fingerprint
+func matchFingerprints(matches []*fingerprintMatch, response *http.Response, body []byte) (*fingerprintMatch, *httpFingerprint, bool) {
+	cookies := response.Cookies()
+	for _, match := range matches {
+		for i := range match.fingerprints {
+			if match.fingerprints[i].match(response, cookies, body) {
+				return match, &match.fingerprints[i], true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// CheckHTTPResponse checks if the headers, cookies and status of an http
+// response match the fingerprints of a provider
+func (c *Client) CheckHTTPResponse(response *http.Response) (matched bool, provider string, itemType string, err error) {
+	result, err := c.CheckHTTPResponseResult(response)
+	if err != nil {
+		return false, "", "", err
+	}
+	matched, provider, itemType = result.tuple()
+	return matched, provider, itemType, nil
+}
+
+// CheckHTTPResponseResult is same as CheckHTTPResponse but returns the
+// matched fingerprint along with the provider. The start of the body is
+// read when fingerprints match on it, the body staying readable.
+func (c *Client) CheckHTTPResponseResult(response *http.Response) (*Result, error) {
+	if response == nil {
+		return nil, errors.New("no http response specified")
+	}
+	result := &Result{}
+	if response.Request != nil && response.Request.URL != nil {
+		result.Input = response.Request.URL.String()
+	}
+	index := c.index()
+	var body []byte
+	if index.fingerprintBody {
+		var err error
+		if body, err = peekBody(response); err != nil {
+			return nil, err
+		}
+	}
+	if match, fingerprint, ok := matchFingerprints(index.fingerprints, response, body); ok {
+		result.Matched = true
+		result.Category = match.categories[0]
+		result.Categories = slices.Clone(match.categories)
+		result.Provider = match.provider
+		result.Fingerprint = fingerprint.String()
+		result.Method = DetectionMethodHTTP
+	}
+	return index.identify(result), nil
+}
@@ -0,0 +1,141 @@
+package cdncheck
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHTTPResponse(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		cookie      string
+		provider    string
+		fingerprint string
+	}{
+		{name: "header", headers: map[string]string{"CF-RAY": "8a1b2c3d4e5f6789-FRA"}, provider: "cloudflare", fingerprint: "header:cf-ray"},
+		{name: "value", headers: map[string]string{"Server": "AkamaiGHost"}, provider: "akamai", fingerprint: "header:server=^AkamaiGHost"},
+		{name: "cookie", cookie: "incap_ses_123_456=token", provider: "incapsula", fingerprint: "cookie:incap_ses_"},
+		{name: "waf", headers: map[string]string{"X-Sucuri-ID": "11005"}, provider: "sucuri", fingerprint: "header:x-sucuri-id"},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			for key, value := range test.headers {
+				w.Header().Set(key, value)
+			}
+			if test.cookie != "" {
+				w.Header().Add("Set-Cookie", test.cookie+"; Path=/")
+			}
+		}))
+		response, err := http.Get(server.URL)
+		require.Nil(t, err, "could not request %s server", test.name)
+		_ = response.Body.Close()
+		server.Close()
+
+		result, err := client.CheckHTTPResponseResult(response)
+		require.Nil(t, err, "could not check %s response", test.name)
+		require.True(t, result.Matched, "could not match %s response", test.name)
+		require.Equal(t, test.provider, result.Provider, "could not get provider of %s response", test.name)
+		require.Equal(t, test.fingerprint, result.Fingerprint, "could not get fingerprint of %s response", test.name)
+		require.Equal(t, DetectionMethodHTTP, result.Method, "could not get detection method of %s response", test.name)
+		require.Equal(t, server.URL, result.Input, "could not get input of %s response", test.name)
+
+		matched, provider, itemType, err := client.CheckHTTPResponse(response)
+		require.Nil(t, err, "could not check %s response", test.name)
+		require.True(t, matched, "could not match %s response", test.name)
+		require.Equal(t, test.provider, provider, "could not get provider of %s response", test.name)
+		require.Equal(t, result.Category, itemType, "could not get category of %s response", test.name)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Server", "nginx")
+	}))
+	defer server.Close()
+	response, err := http.Get(server.URL)
+	require.Nil(t, err, "could not request server")
+	_ = response.Body.Close()
+	matched, _, _, err := client.CheckHTTPResponse(response)
+	require.Nil(t, err, "could not check response")
+	require.False(t, matched, "could match response without fingerprint")
+
+	_, err = client.CheckHTTPResponseResult(nil)
+	require.NotNil(t, err, "could check nil response")
+}
+
+func TestCheckHTTPResponseCustomData(t *testing.T) {
+	data := &InputCompiled{
+		Fingerprints: map[string][]HTTPFingerprint{
+			"edge":   {{Header: "X-Edge-Block", Status: []int{403}}, {Header: "Via", Value: `edge-\d+`}},
+			"shield": {{Cookie: "shield_"}},
+		},
+		FingerprintCategories: map[string][]string{
+			"edge": {"cdn", "waf"},
+		},
+	}
+	client, err := NewClient(WithData(data))
+	require.Nil(t, err, "could not create client")
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Edge-Block", "1")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	request := func() *http.Response {
+		response, err := http.Get(server.URL)
+		require.Nil(t, err, "could not request server")
+		_ = response.Body.Close()
+		return response
+	}
+
+	matched, _, _, err := client.CheckHTTPResponse(request())
+	require.Nil(t, err, "could not check response")
+	require.False(t, matched, "could match fingerprint of another status")
+
+	status = http.StatusForbidden
+	result, err := client.CheckHTTPResponseResult(request())
+	require.Nil(t, err, "could not check response")
+	require.True(t, result.Matched, "could not match fingerprint of status")
+	require.Equal(t, "edge", result.Provider, "could not get provider")
+	require.Equal(t, []string{"cdn", "waf"}, result.Categories, "could not get categories")
+	require.Equal(t, "header:x-edge-block status:403", result.Fingerprint, "could not get fingerprint")
+
+	response := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Set-Cookie": {"shield_session=1"}}}
+	result, err = client.CheckHTTPResponseResult(response)
+	require.Nil(t, err, "could not check response")
+	require.Equal(t, "shield", result.Provider, "could not match cookie prefix")
+	require.Equal(t, "waf", result.Category, "could not get default category")
+
+	client, err = NewClient(WithData(data), WithCategories("waf"))
+	require.Nil(t, err, "could not create client")
+	response = &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Via": {"1.1 EDGE-42"}}}
+	result, err = client.CheckHTTPResponseResult(response)
+	require.Nil(t, err, "could not check response")
+	require.Equal(t, "edge", result.Provider, "could not match case insensitive value")
+	require.Equal(t, []string{"waf"}, result.Categories, "could not restrict categories")
+
+	data.Fingerprints["page"] = []HTTPFingerprint{{Body: `<meta name="generator" content="page-edge">`}}
+	client, err = NewClient(WithData(data))
+	require.Nil(t, err, "could not create client")
+	response = &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`<html><meta name="GENERATOR" content="page-edge"></html>`))}
+	result, err = client.CheckHTTPResponseResult(response)
+	require.Nil(t, err, "could not check response")
+	require.Equal(t, "page", result.Provider, "could not match body")
+	body, err := io.ReadAll(response.Body)
+	require.Nil(t, err, "could not read body after check")
+	require.Contains(t, string(body), "page-edge", "could not read body after check")
+
+	client, err = NewClient(WithData(data), WithCategories("cloud"))
+	require.Nil(t, err, "could not create client")
+	matched, _, _, err = client.CheckHTTPResponse(response)
+	require.Nil(t, err, "could not check response")
+	require.False(t, matched, "could match fingerprint of disabled category")
+}
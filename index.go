@@ -0,0 +1,221 @@
+package cdncheck
+
+import (
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// dataIndex contains the lookup structures built from the provider data.
+//
+// An index is never modified once built, reloading the data builds a new
+// one which is swapped in atomically while lookups keep using the old one.
+type dataIndex struct {
+	scrapers          map[string]*providerScraper
+	categories        []categoryScraper
+	info              []CategoryInfo
+	suffixes          *suffixTrie
+	fingerprints      []*fingerprintMatch
+	fingerprintBody   bool
+	blockFingerprints []*fingerprintMatch
+	tlsIssuers        []*tlsIssuerMatch
+	nameservers       []*nameserverMatch
+	registry          *providerRegistry
+	asn               *asnTable
+}
+
+// categoryScraper pairs a category with the scraper of its ranges
+type categoryScraper struct {
+	name    string
+	scraper *providerScraper
+}
+
+// index returns the current index of the client
+func (c *Client) index() *dataIndex {
+	return c.data.Load()
+}
+
+// embeddedIndexes caches the indexes of the embedded data by enabled
+// categories, so clients without custom providers share them
+var embeddedIndexes sync.Map
+
+// buildIndex returns the index of the data with the custom providers
+// applied over it for the enabled categories
+func (o *clientOptions) buildIndex(data *InputCompiled, providers map[string]map[string]*customProvider) *dataIndex {
+	if embedded, err := embeddedData(); err != nil || embedded != data || len(providers) > 0 {
+		return o.newIndex(data, providers)
+	}
+	key := strings.Join(o.categories, ",")
+	if index, ok := embeddedIndexes.Load(key); ok {
+		return index.(*dataIndex)
+	}
+	index, _ := embeddedIndexes.LoadOrStore(key, o.newIndex(data, providers))
+	return index.(*dataIndex)
+}
+
+// newIndex builds the index of the data with the custom providers
+func (o *clientOptions) newIndex(data *InputCompiled, providers map[string]map[string]*customProvider) *dataIndex {
+	index := &dataIndex{
+		scrapers: make(map[string]*providerScraper),
+		info:     data.categoryList(),
+	}
+	for _, category := range index.info {
+		scraper := newPrefixScraper(o.ranges(data, providers, category.Name))
+		index.scrapers[category.Name] = scraper
+		if o.enabled(category.Name) {
+			index.categories = append(index.categories, categoryScraper{name: category.Name, scraper: scraper})
+		}
+	}
+	index.suffixes = newSuffixTrie(o.suffixes(data, providers))
+	index.fingerprints = o.fingerprints(data, providers)
+	index.fingerprintBody = slices.ContainsFunc(index.fingerprints, func(match *fingerprintMatch) bool {
+		return slices.ContainsFunc(match.fingerprints, func(fingerprint httpFingerprint) bool { return fingerprint.body != nil })
+	})
+	index.blockFingerprints = o.blockFingerprints(data, providers)
+	index.tlsIssuers = o.tlsIssuers(data, providers)
+	index.nameservers = o.nameservers(data, providers)
+	index.registry = newProviderRegistry(data.Registry)
+	index.asn = newASNTable(data.ASN)
+	return index
+}
+
+// ranges returns the parsed ranges of a category with the custom providers
+// applied, or nil if the category is not enabled
+func (o *clientOptions) ranges(data *InputCompiled, providers map[string]map[string]*customProvider, category string) map[string][]netip.Prefix {
+	if !o.enabled(category) {
+		return nil
+	}
+	base := data.prefixes(category)
+	if len(providers[category]) == 0 {
+		return base
+	}
+	merged := make(map[string][]netip.Prefix, len(base)+len(providers[category]))
+	for provider, prefixes := range base {
+		merged[provider] = prefixes
+	}
+	for provider, custom := range providers[category] {
+		if custom.replace {
+			// the services and regions of the provider are replaced along with it
+			maps.DeleteFunc(merged, func(name string, _ []netip.Prefix) bool {
+				root, _ := SplitProviderPath(name)
+				return root == provider
+			})
+		}
+		if len(custom.cidrs) > 0 {
+			merged[provider] = append(slices.Clip(merged[provider]), parsePrefixes(custom.cidrs)...)
+		}
+	}
+	return merged
+}
+
+// defaultSuffixCategory is the category of sources declaring none, as
+// was the case for all of them before suffix categories were introduced
+const defaultSuffixCategory = "waf"
+
+// suffixes returns the suffixes of the data with the custom providers
+// applied over them, each with its enabled categories, sorted by provider
+func (o *clientOptions) suffixes(data *InputCompiled, providers map[string]map[string]*customProvider) []*suffixMatch {
+	type source struct {
+		suffixes   []string
+		categories map[string][]string
+	}
+	sources := make(map[string]*source)
+	add := func(provider, suffix string, categories ...string) {
+		item, ok := sources[provider]
+		if !ok {
+			item = &source{categories: make(map[string][]string)}
+			sources[provider] = item
+		}
+		if _, ok := item.categories[suffix]; !ok {
+			item.suffixes = append(item.suffixes, suffix)
+		}
+		item.categories[suffix] = appendUnique(item.categories[suffix], categories...)
+	}
+
+	for provider, suffixes := range data.Common {
+		declared := data.CommonCategories[provider]
+		if len(declared) == 0 {
+			declared = []string{defaultSuffixCategory}
+		}
+		for _, suffix := range suffixes {
+			add(provider, suffix, declared...)
+		}
+	}
+	// a replaced provider keeps its suffixes for the other categories only
+	categories := slices.Sorted(maps.Keys(providers))
+	for _, category := range categories {
+		for provider, item := range providers[category] {
+			if !item.replace || sources[provider] == nil {
+				continue
+			}
+			for suffix, categories := range sources[provider].categories {
+				sources[provider].categories[suffix] = slices.DeleteFunc(slices.Clone(categories), func(value string) bool {
+					return value == category
+				})
+			}
+		}
+	}
+	for _, category := range categories {
+		for provider, item := range providers[category] {
+			for _, suffix := range item.suffixes {
+				add(provider, suffix, category)
+			}
+		}
+	}
+
+	var matches []*suffixMatch
+	for _, provider := range slices.Sorted(maps.Keys(sources)) {
+		item := sources[provider]
+		for _, suffix := range item.suffixes {
+			var categories []string
+			for _, category := range item.categories[suffix] {
+				if o.enabled(category) {
+					categories = append(categories, category)
+				}
+			}
+			if len(categories) == 0 {
+				continue
+			}
+			matches = append(matches, &suffixMatch{provider: provider, suffix: suffix, categories: categories})
+		}
+	}
+	return matches
+}
+
+// scraper returns the scraper of a category, or nil if the data has no
+// such category
+func (idx *dataIndex) scraper(category string) *providerScraper {
+	return idx.scrapers[category]
+}
+
+// lookup returns the first category in check order containing the address
+func (idx *dataIndex) lookup(addr netip.Addr) (category, provider string, prefix netip.Prefix, ok bool) {
+	for _, item := range idx.categories {
+		if prefix, provider, ok := item.scraper.lookup(addr); ok {
+			return item.name, provider, prefix, true
+		}
+	}
+	return "", "", netip.Prefix{}, false
+}
+
+// checkResult returns the result of checking an ip against the index
+func (idx *dataIndex) checkResult(ip net.IP) (*Result, error) {
+	addr, err := toAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Input: ip.String(), IPs: []string{ip.String()}}
+	if category, provider, prefix, ok := idx.lookup(addr); ok {
+		result.Matched = true
+		result.Category = category
+		result.Categories = []string{category}
+		result.Provider, result.Path = providerMatch(provider)
+		result.Prefix = prefix.String()
+		result.Method = DetectionMethodIP
+	}
+	idx.setASN(result, result.Input)
+	return result, nil
+}
@@ -1,8 +1,12 @@
 package runner
 
 import (
+	"cmp"
+	"context"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/logrusorgru/aurora"
@@ -26,26 +30,106 @@ type Output struct {
 	CloudName string    `json:"cloud_name,omitempty"`
 	Waf       bool      `json:"waf,omitempty"`
 	WafName   string    `json:"waf_name,omitempty"`
-	itemType  string
+	// Category is the category of the detected provider
+	Category string `json:"category,omitempty"`
+	// Categories contains all the categories the provider is reported as
+	Categories []string `json:"categories,omitempty"`
+	// Provider is the name of the detected provider
+	Provider string `json:"provider,omitempty"`
+	// ProviderID is the id of the detected provider in the registry
+	ProviderID string `json:"provider_id,omitempty"`
+	// Path is the hierarchical name of the service and region of the provider
+	Path string `json:"path,omitempty"`
+	// Tags contains the tags of the detected provider in the registry
+	Tags []string `json:"tags,omitempty"`
+	// Prefix is the CIDR which matched for ip based detections
+	Prefix string `json:"prefix,omitempty"`
+	// Suffix is the suffix which matched for cname based detections
+	Suffix string `json:"suffix,omitempty"`
+	// Fingerprint is the http fingerprint, or the certificate name or
+	// issuer, which matched in probe and tls modes
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Method is the source the provider was detected from
+	Method cdncheck.DetectionMethod `json:"method,omitempty"`
+	// IPs contains all the ips the input resolved to
+	IPs []string `json:"ips,omitempty"`
+	// CNAMEs contains the cname chain of the input
+	CNAMEs []string `json:"cnames,omitempty"`
+	// Chain contains the cname chain with the provider attributed to each hop
+	Chain []cdncheck.Hop `json:"chain,omitempty"`
+	// Matches contains every category and provider matching the ip
+	Matches []cdncheck.Match `json:"matches,omitempty"`
+	// ASN is the number of the autonomous system announcing the ip
+	ASN uint32 `json:"asn,omitempty"`
+	// ASNOrg is the organization operating the autonomous system
+	ASNOrg string `json:"asn_org,omitempty"`
+	// Country is the iso code of the country of the ip
+	Country string `json:"country,omitempty"`
+	// NS contains the nameservers of the registrable domain of the host
+	NS []string `json:"ns,omitempty"`
+	// DNSProvider is the dns provider detected from the nameservers
+	DNSProvider string `json:"dns_provider,omitempty"`
+	// TLS contains the tls handshake of the host in tls mode
+	TLS *cdncheck.TLSInfo `json:"tls,omitempty"`
+	// WAFProbe is the result of actively probing the host for a waf
+	WAFProbe *WAFProbe `json:"waf_probe,omitempty"`
+	itemType string
+	showASN  bool
+}
+
+// WAFProbe is the result of actively probing a host for a waf
+type WAFProbe struct {
+	// Vendor is the waf vendor identified from the responses
+	Vendor string `json:"vendor,omitempty"`
+	// Blocked is true if a request with an attack pattern was blocked
+	Blocked bool `json:"blocked"`
+	// Payload is the name of the first blocked request, e.g. xss
+	Payload string `json:"payload,omitempty"`
+	// Status is the status code of the first blocked response
+	Status int `json:"status,omitempty"`
 }
 
 func (o *Output) String() string {
 	sw := *o.aurora
-	commonName := "[%s]"
-	itemType := fmt.Sprintf("[%s]", o.itemType)
-	switch o.itemType {
+	parts := []string{o.Input}
+	if o.itemType != "" {
+		parts = append(parts, colorCategory(sw, o.itemType, fmt.Sprintf("[%s]", o.itemType)))
+		parts = append(parts, sw.BrightYellow(fmt.Sprintf("[%s]", cmp.Or(o.Path, o.Provider))).String())
+	}
+	if o.showASN && o.ASN != 0 {
+		parts = append(parts, sw.BrightCyan(fmt.Sprintf("[AS%d]", o.ASN)).String())
+		if o.ASNOrg != "" {
+			parts = append(parts, sw.Cyan(fmt.Sprintf("[%s]", o.ASNOrg)).String())
+		}
+	}
+	if o.showASN && o.Country != "" {
+		parts = append(parts, sw.White(fmt.Sprintf("[%s]", o.Country)).String())
+	}
+	if o.DNSProvider != "" {
+		parts = append(parts, colorCategory(sw, "dns", fmt.Sprintf("[dns:%s]", o.DNSProvider)))
+	}
+	if o.WAFProbe != nil && o.WAFProbe.Blocked {
+		parts = append(parts, sw.BrightRed(fmt.Sprintf("[blocked:%s]", o.WAFProbe.Payload)).String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// hasCategory returns true if the provider of the output is reported as the category
+func (o *Output) hasCategory(category string) bool {
+	return o.Category == category || slices.Contains(o.Categories, category)
+}
+
+// colorCategory colors a value with the color of a category
+func colorCategory(sw aurora.Aurora, category, value string) string {
+	switch category {
 	case "cdn":
-		commonName = fmt.Sprintf(commonName, o.CdnName)
-		itemType = sw.BrightBlue(itemType).String()
+		return sw.BrightBlue(value).String()
 	case "cloud":
-		commonName = fmt.Sprintf(commonName, o.CloudName)
-		itemType = sw.BrightGreen(itemType).String()
+		return sw.BrightGreen(value).String()
 	case "waf":
-		commonName = fmt.Sprintf(commonName, o.WafName)
-		itemType = sw.Yellow(itemType).String()
+		return sw.Yellow(value).String()
 	}
-	commonName = sw.BrightYellow(commonName).String()
-	return fmt.Sprintf("%s %s %s", o.Input, itemType, commonName)
+	return sw.BrightMagenta(value).String()
 }
 func (o *Output) StringIP() string {
 	return o.IP
@@ -73,9 +157,162 @@ type Options struct {
 	FilterCdn          goflags.StringSlice
 	FilterCloud        goflags.StringSlice
 	FilterWaf          goflags.StringSlice
-	Resolvers          goflags.StringSlice
-	OnResult           func(r Output)
-	MaxRetries         int
+	// Categories contains the categories to display in cli output
+	Categories goflags.StringSlice
+	// MatchProviders contains the providers to match as category:provider or provider
+	MatchProviders goflags.StringSlice
+	// FilterProviders contains the providers to filter as category:provider or provider
+	FilterProviders goflags.StringSlice
+	// ASN displays the autonomous system of the inputs, including the unmatched ones
+	ASN bool
+	// ASNData is an ip to asn table file generated by generate-index
+	ASNData string
+	// MatchASN contains the autonomous systems to match
+	MatchASN goflags.StringSlice
+	// FilterASN contains the autonomous systems to filter
+	FilterASN goflags.StringSlice
+	// MMDB contains the mmdb databases used to enrich the results
+	MMDB goflags.StringSlice
+	// MMDBMap contains the autonomous systems or organizations attributed
+	// to providers as asn=category:provider or org=category:provider
+	MMDBMap   goflags.StringSlice
+	Resolvers goflags.StringSlice
+	// IPFamily is the address family of the default resolvers, either 4, 6 or auto
+	IPFamily      string
+	OnResult      func(r Output)
+	MaxRetries    int
+	MaxCNAMEDepth int
+	// Providers is a provider.yaml file merged with the embedded data
+	Providers string
+	// Offline allows only static cidr and fqdn entries in the providers file
+	Offline bool
+	// DataInfo displays the metadata of the provider data instead of checking inputs
+	DataInfo bool
+	// MaxDataAge is the age in days after which a warning is shown for the provider data
+	MaxDataAge int
+	// NS resolves the nameservers of the registrable domain of each host
+	// to detect its dns provider
+	NS bool
+	// Probe requests each host over https to match its response against
+	// the http fingerprints of the providers
+	Probe bool
+	// WAFProbe sends requests with benign attack patterns to each host to
+	// detect its waf from the block pages and whether it blocks them
+	WAFProbe bool
+	// TLS connects to each host over tls to match its certificate chain
+	// against the suffixes and certificate issuers of the providers
+	TLS bool
+	// ProbeTimeout is the timeout in seconds of a probe request or tls
+	// handshake
+	ProbeTimeout int
+}
+
+// displayCategories returns the categories to display in cli output,
+// including the ones of the cdn, cloud and waf flags
+func (options *Options) displayCategories() []string {
+	categories := slices.Clone(options.Categories)
+	for category, enabled := range map[string]bool{"cdn": options.Cdn, "cloud": options.Cloud, "waf": options.Waf} {
+		if enabled && !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// matchProviders returns the providers to match by category, an empty
+// category matching providers of any category
+func (options *Options) matchProviders() map[string][]string {
+	return providerFilters(options.MatchProviders, map[string][]string{"cdn": options.MatchCdn, "cloud": options.MatchCloud, "waf": options.MatchWaf})
+}
+
+// filterProviders returns the providers to filter by category, an empty
+// category filtering providers of any category
+func (options *Options) filterProviders() map[string][]string {
+	return providerFilters(options.FilterProviders, map[string][]string{"cdn": options.FilterCdn, "cloud": options.FilterCloud, "waf": options.FilterWaf})
+}
+
+// providerFilters groups category:provider values by category along
+// with the providers of the per category flags
+func providerFilters(values []string, categories map[string][]string) map[string][]string {
+	filters := make(map[string][]string)
+	for _, value := range values {
+		category, provider, ok := strings.Cut(value, ":")
+		if !ok {
+			category, provider = "", value
+		}
+		filters[category] = append(filters[category], provider)
+	}
+	for category, providers := range categories {
+		if len(providers) > 0 {
+			filters[category] = append(filters[category], providers...)
+		}
+	}
+	return filters
+}
+
+// defaultProviderIDs returns the registry ids of the providers having ranges
+// in each default category of the embedded data, for the help of the flags
+func defaultProviderIDs() map[string]string {
+	ids := map[string]string{
+		"cdn":   cdncheck.DefaultCDNProviders,
+		"waf":   cdncheck.DefaultWafProviders,
+		"cloud": cdncheck.DefaultCloudProviders,
+	}
+	data, err := cdncheck.NewEmbeddedSource().Load(context.Background())
+	if err != nil {
+		return ids
+	}
+	for category := range ids {
+		ids[category] = strings.Join(data.CategoryProviderIDs(category), ", ")
+	}
+	return ids
+}
+
+// parseASNs parses the autonomous system numbers of the asn flags
+func parseASNs(values []string) ([]uint32, error) {
+	numbers := make([]uint32, 0, len(values))
+	for _, value := range values {
+		number, err := cdncheck.ParseASN(value)
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+// parseIPFamily parses the address family of the ip-family flag
+func parseIPFamily(value string) (cdncheck.IPFamily, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "auto":
+		return cdncheck.IPFamilyAuto, nil
+	case "4", "ipv4":
+		return cdncheck.IPFamilyIPv4, nil
+	case "6", "ipv6":
+		return cdncheck.IPFamilyIPv6, nil
+	}
+	return cdncheck.IPFamilyAuto, fmt.Errorf("invalid ip family %q, expected 4, 6 or auto", value)
+}
+
+// parseASNRules parses the rules of the mmdb map flag, given as
+// AS13335=waf:cloudflare or cloudflare=waf:cloudflare for organizations
+func parseASNRules(values []string) ([]cdncheck.ASNRule, error) {
+	rules := make([]cdncheck.ASNRule, 0, len(values))
+	for _, value := range values {
+		match, target, ok := strings.Cut(value, "=")
+		category, provider, found := strings.Cut(target, ":")
+		if !ok || !found || strings.TrimSpace(match) == "" {
+			return nil, fmt.Errorf("invalid rule %q, expected asn=category:provider or org=category:provider", value)
+		}
+		rule := cdncheck.ASNRule{Category: strings.TrimSpace(category), Provider: strings.TrimSpace(provider)}
+		if number, err := cdncheck.ParseASN(match); err == nil {
+			rule.ASN = []uint32{number}
+		} else {
+			rule.Orgs = []string{strings.TrimSpace(match)}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
 }
 
 // configureOutput configures the output logging levels to be displayed on the screen
@@ -108,6 +345,8 @@ func readFlags() (*Options, error) {
 	opts := &Options{}
 	opts.HasStdin = fileutil.HasStdin()
 
+	providerIDs := defaultProviderIDs()
+
 	flagSet := goflags.NewFlagSet()
 	flagSet.SetDescription("cdncheck is a tool for identifying the technology associated with dns / ip network addresses.")
 
@@ -119,34 +358,60 @@ func readFlags() (*Options, error) {
 		flagSet.BoolVarP(&opts.Cdn, "cdn", "", false, "display only cdn in cli output"),
 		flagSet.BoolVarP(&opts.Cloud, "cloud", "", false, "display only cloud in cli output"),
 		flagSet.BoolVarP(&opts.Waf, "waf", "", false, "display only waf in cli output"),
+		flagSet.StringSliceVarP(&opts.Categories, "category", "ct", nil, "display only specified categories in cli output (e.g. cdn,dns)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.BoolVar(&opts.NS, "ns", false, "resolve the nameservers of the registrable domain of each host and detect its dns provider"),
 	)
 
 	flagSet.CreateGroup("matcher", "MATCHER",
-		flagSet.StringSliceVarP(&opts.MatchCdn, "match-cdn", "mcdn", nil, fmt.Sprintf("match host with specified cdn provider (%s)", cdncheck.DefaultCDNProviders), goflags.CommaSeparatedStringSliceOptions),
-		flagSet.StringSliceVarP(&opts.MatchCloud, "match-cloud", "mcloud", nil, fmt.Sprintf("match host with specified cloud provider (%s)", cdncheck.DefaultCloudProviders), goflags.CommaSeparatedStringSliceOptions),
-		flagSet.StringSliceVarP(&opts.MatchWaf, "match-waf", "mwaf", nil, fmt.Sprintf("match host with specified waf provider (%s)", cdncheck.DefaultWafProviders), goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.MatchCdn, "match-cdn", "mcdn", nil, fmt.Sprintf("match host with specified cdn provider id or alias (%s)", providerIDs["cdn"]), goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.MatchCloud, "match-cloud", "mcloud", nil, fmt.Sprintf("match host with specified cloud provider id or alias (%s)", providerIDs["cloud"]), goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.MatchWaf, "match-waf", "mwaf", nil, fmt.Sprintf("match host with specified waf provider id or alias (%s)", providerIDs["waf"]), goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.MatchProviders, "match-provider", "mp", nil, "match host with specified provider id or alias of any category (category:provider or provider)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.MatchASN, "match-asn", "masn", nil, "match host announced by specified autonomous systems, matched by a provider or not (e.g. AS13335,16509)", goflags.CommaSeparatedStringSliceOptions),
 	)
 
 	flagSet.CreateGroup("filter", "FILTER",
-		flagSet.StringSliceVarP(&opts.FilterCdn, "filter-cdn", "fcdn", nil, fmt.Sprintf("filter host with specified cdn provider (%s)", cdncheck.DefaultCDNProviders), goflags.CommaSeparatedStringSliceOptions),
-		flagSet.StringSliceVarP(&opts.FilterCloud, "filter-cloud", "fcloud", nil, fmt.Sprintf("filter host with specified cloud provider (%s)", cdncheck.DefaultCloudProviders), goflags.CommaSeparatedStringSliceOptions),
-		flagSet.StringSliceVarP(&opts.FilterWaf, "filter-waf", "fwaf", nil, fmt.Sprintf("filter host with specified waf provider (%s)", cdncheck.DefaultWafProviders), goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.FilterCdn, "filter-cdn", "fcdn", nil, fmt.Sprintf("filter host with specified cdn provider id or alias (%s)", providerIDs["cdn"]), goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.FilterCloud, "filter-cloud", "fcloud", nil, fmt.Sprintf("filter host with specified cloud provider id or alias (%s)", providerIDs["cloud"]), goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.FilterWaf, "filter-waf", "fwaf", nil, fmt.Sprintf("filter host with specified waf provider id or alias (%s)", providerIDs["waf"]), goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.FilterProviders, "filter-provider", "fp", nil, "filter host with specified provider id or alias of any category (category:provider or provider)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.FilterASN, "filter-asn", "fasn", nil, "filter host announced by specified autonomous systems (e.g. AS13335,16509)", goflags.CommaSeparatedStringSliceOptions),
 	)
 
 	flagSet.CreateGroup("output", "OUTPUT",
 		flagSet.BoolVarP(&opts.Response, "resp", "", false, "display technology name in cli output"),
+		flagSet.BoolVar(&opts.ASN, "asn", false, "display asn, organization and country in cli output, including hosts matching no provider"),
 		flagSet.StringVarP(&opts.Output, "output", "o", "", "write output in plain format to file"),
 		flagSet.BoolVarP(&opts.Verbose, "verbose", "v", false, "display verbose output"),
 		flagSet.BoolVarP(&opts.Json, "jsonl", "j", false, "write output in json(line) format"),
 		flagSet.BoolVarP(&opts.NoColor, "no-color", "nc", false, "disable colors in cli output"),
 		flagSet.BoolVarP(&opts.Version, "version", "", false, "display version of the project"),
 		flagSet.BoolVar(&opts.Silent, "silent", false, "only display results in output"),
+		flagSet.BoolVar(&opts.DataInfo, "data-info", false, "display generation time and sources of the provider data"),
 	)
 
 	flagSet.CreateGroup("config", "CONFIG",
 		flagSet.StringSliceVarP(&opts.Resolvers, "resolver", "r", nil, "list of resolvers to use (file or comma separated)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringVar(&opts.IPFamily, "ip-family", "auto", "address family of the default resolvers (4, 6 or auto to prefer ipv6 and fall back to ipv4)"),
 		flagSet.BoolVarP(&opts.Exclude, "exclude", "e", false, "exclude detected ip from output"),
 		flagSet.IntVar(&opts.MaxRetries, "retry", 2, "maximum number of retries for dns resolution (must be at least 1)"),
+		flagSet.IntVar(&opts.MaxCNAMEDepth, "cname-depth", cdncheck.DefaultMaxCNAMEDepth, "maximum number of cnames to follow for a domain"),
+		flagSet.StringVarP(&opts.Providers, "providers", "p", "", "provider.yaml file with custom providers, replacing the embedded ranges and suffixes of providers with the same name"),
+		flagSet.BoolVar(&opts.Offline, "offline", false, "allow only static cidr and fqdn entries in the providers file"),
+		flagSet.IntVar(&opts.MaxDataAge, "data-max-age", 30, "warn when provider data is older than specified days (0 to disable)"),
+		flagSet.StringVar(&opts.ASNData, "asn-data", "", "ip to asn table file generated by generate-index -asn-input"),
+	)
+
+	flagSet.CreateGroup("probe", "PROBE",
+		flagSet.BoolVar(&opts.Probe, "probe", false, "send one https request per host and match the response headers, cookies and status against provider fingerprints"),
+		flagSet.BoolVarP(&opts.WAFProbe, "waf-probe", "wp", false, "send requests with benign attack patterns to each host to detect the waf vendor from its block pages and whether it blocks"),
+		flagSet.BoolVar(&opts.TLS, "tls", false, "connect to port 443 of each host and match the certificate names and issuers against provider data"),
+		flagSet.IntVar(&opts.ProbeTimeout, "probe-timeout", 10, "timeout in seconds of a probe request or tls handshake"),
+	)
+
+	flagSet.CreateGroup("mmdb", "MMDB",
+		flagSet.StringSliceVar(&opts.MMDB, "mmdb", nil, "mmdb databases to enrich hosts with country, asn and organization (e.g. GeoLite2-ASN.mmdb,GeoLite2-Country.mmdb)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&opts.MMDBMap, "mmdb-map", "mm", nil, "attribute hosts of an asn or organization to a provider (e.g. AS13335=waf:cloudflare,fastly=cdn:fastly)", goflags.CommaSeparatedStringSliceOptions),
 	)
 
 	flagSet.CreateGroup("update", "UPDATE",
@@ -0,0 +1,25 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/projectdiscovery/cdncheck"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIPFamily(t *testing.T) {
+	tests := map[string]cdncheck.IPFamily{
+		"":     cdncheck.IPFamilyAuto,
+		"auto": cdncheck.IPFamilyAuto,
+		"4":    cdncheck.IPFamilyIPv4,
+		"6":    cdncheck.IPFamilyIPv6,
+		"IPv6": cdncheck.IPFamilyIPv6,
+	}
+	for value, expected := range tests {
+		family, err := parseIPFamily(value)
+		require.Nil(t, err, "could not parse ip family %q", value)
+		require.Equal(t, expected, family, "could not get ip family of %q", value)
+	}
+	_, err := parseIPFamily("5")
+	require.NotNil(t, err, "could parse invalid ip family")
+}
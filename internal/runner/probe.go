@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/projectdiscovery/cdncheck"
+)
+
+// probeUserAgent is the user agent of the probe requests
+const probeUserAgent = "Mozilla/5.0 (compatible; cdncheck)"
+
+// newProbeClient returns the http client of the probe requests, which
+// does not follow redirects so a single request is made per host
+func newProbeClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			// hosts are probed by ip or name regardless of their certificate
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			MaxIdleConnsPerHost: 1,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// probeURL returns the url requested to probe a host on a port
+func probeURL(host, port string) string {
+	address := net.JoinHostPort(host, port)
+	if port == "443" {
+		address = strings.TrimSuffix(address, ":443")
+	}
+	return "https://" + address + "/"
+}
+
+// probe requests a host over https and checks the response against the
+// http fingerprints of the providers
+func (r *Runner) probe(ctx context.Context, host string) (*cdncheck.Result, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL(host, r.probePort), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", probeUserAgent)
+	response, err := r.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+		_ = response.Body.Close()
+	}()
+	return r.cdnclient.CheckHTTPResponseResult(response)
+}
+
+// checkTLS connects to the probe port of a host and checks its certificate
+// chain against the data
+func (r *Runner) checkTLS(ctx context.Context, host string) (*cdncheck.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.options.ProbeTimeout)*time.Second)
+	defer cancel()
+	return r.cdnclient.CheckTLS(ctx, net.JoinHostPort(host, r.probePort))
+}
+
+// mergeProbe merges the result of probing a host into its result. An
+// unmatched host takes the provider of the probe and the fingerprint is
+// kept as evidence of the same provider, while another provider is
+// returned to be added to the matches of the host.
+func (r *Runner) mergeProbe(result, probe *cdncheck.Result) *cdncheck.Match {
+	if probe == nil || !probe.Matched {
+		return nil
+	}
+	switch {
+	case !result.Matched:
+		result.Matched = true
+		result.Category = probe.Category
+		result.Categories = probe.Categories
+		result.Provider = probe.Provider
+		result.ProviderID = probe.ProviderID
+		result.Path = ""
+		result.Fingerprint = probe.Fingerprint
+		result.Method = probe.Method
+	case r.cdnclient.ProviderID(result.Provider) == r.cdnclient.ProviderID(probe.Provider):
+		result.Fingerprint = probe.Fingerprint
+		for _, category := range probe.Categories {
+			if !slices.Contains(result.Categories, category) {
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	default:
+		return &cdncheck.Match{Category: probe.Category, Provider: probe.Provider}
+	}
+	return nil
+}
@@ -2,10 +2,15 @@ package runner
 
 import (
 	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +18,7 @@ import (
 	"github.com/logrusorgru/aurora"
 	"github.com/pkg/errors"
 	"github.com/projectdiscovery/cdncheck"
+	"github.com/projectdiscovery/cdncheck/generate"
 	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/mapcidr"
 	iputils "github.com/projectdiscovery/utils/ip"
@@ -23,38 +29,210 @@ type Runner struct {
 	cdnclient *cdncheck.Client
 	aurora    *aurora.Aurora
 	writer    *OutputWriter
+	matchASN  []uint32
+	filterASN []uint32
+	// httpClient requests the hosts in probe and waf probe modes
+	httpClient *http.Client
+	// probePort is the port hosts are requested on in probe, waf probe
+	// and tls modes
+	probePort string
 }
 
 func NewRunner(options *Options) *Runner {
 	standardWriter := aurora.NewAurora(!options.NoColor)
-	client, err := cdncheck.NewWithOpts(options.MaxRetries, options.Resolvers)
+	ipFamily, err := parseIPFamily(options.IPFamily)
+	if err != nil {
+		gologger.Fatal().Msgf("invalid ip family: %v", err)
+	}
+	clientOptions := []cdncheck.Option{
+		cdncheck.WithMaxRetries(options.MaxRetries),
+		cdncheck.WithResolvers(options.Resolvers...),
+		cdncheck.WithIPFamily(ipFamily),
+		cdncheck.WithMaxCNAMEDepth(options.MaxCNAMEDepth),
+	}
+	sources := []cdncheck.DataSource{cdncheck.NewEmbeddedSource()}
+	if options.Providers != "" {
+		compiled, err := compileProviders(options)
+		if err != nil {
+			gologger.Fatal().Msgf("failed to compile providers: %v", err)
+		}
+		if embedded, err := sources[0].Load(context.Background()); err == nil {
+			if replaced := replacedProviders(embedded, compiled); len(replaced) > 0 {
+				gologger.Info().Msgf("Providers file replaces the embedded ranges of %s", strings.Join(replaced, ", "))
+			}
+		}
+		sources = append(sources, cdncheck.NewStaticSource(compiled))
+	}
+	if options.ASNData != "" {
+		sources = append(sources, cdncheck.NewFileSource(options.ASNData))
+	} else if len(options.MMDB) == 0 && (options.ASN || len(options.MatchASN) > 0 || len(options.FilterASN) > 0 || len(options.MMDBMap) > 0) {
+		gologger.Warning().Msgf("No ip to asn table or mmdb database specified with -asn-data or -mmdb, asn of hosts will be unknown")
+	}
+	clientOptions = append(clientOptions, cdncheck.WithDataSources(sources...))
+	rules, err := parseASNRules(options.MMDBMap)
+	if err != nil {
+		gologger.Fatal().Msgf("invalid mmdb map: %v", err)
+	}
+	clientOptions = append(clientOptions, cdncheck.WithMMDB(options.MMDB...), cdncheck.WithASNRules(rules...))
+	matchASN, err := parseASNs(options.MatchASN)
+	if err != nil {
+		gologger.Fatal().Msgf("invalid match asn: %v", err)
+	}
+	filterASN, err := parseASNs(options.FilterASN)
+	if err != nil {
+		gologger.Fatal().Msgf("invalid filter asn: %v", err)
+	}
+	client, err := cdncheck.NewClient(clientOptions...)
 	if err != nil {
 		gologger.Fatal().Msgf("failed to create cdncheck client: %v", err)
 	}
+	if err := validateCategories(options, client); err != nil {
+		gologger.Fatal().Msgf("invalid category: %v", err)
+	}
+	checkDataAge(client.DataInfo(), time.Duration(options.MaxDataAge)*24*time.Hour)
 	runner := &Runner{
 		options:   options,
 		cdnclient: client,
 		aurora:    &standardWriter,
+		matchASN:  matchASN,
+		filterASN: filterASN,
+		probePort: "443",
+	}
+	if options.Probe || options.WAFProbe {
+		runner.httpClient = newProbeClient(time.Duration(options.ProbeTimeout) * time.Second)
 	}
 	return runner
 }
 
+// validateCategories checks the categories of the display, match and
+// filter flags are present in the provider data of the client
+func validateCategories(options *Options, client *cdncheck.Client) error {
+	var known []string
+	for _, category := range client.Categories() {
+		known = append(known, category.Name)
+	}
+	categories := options.displayCategories()
+	for _, filters := range []map[string][]string{options.matchProviders(), options.filterProviders()} {
+		for category := range filters {
+			if category != "" {
+				categories = append(categories, category)
+			}
+		}
+	}
+	for _, category := range categories {
+		if !slices.Contains(known, category) {
+			return fmt.Errorf("%s is not one of %s", category, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// compileProviders compiles the providers file, fetching url and asn
+// entries unless running offline
+func compileProviders(options *Options) (*cdncheck.InputCompiled, error) {
+	categories, err := generate.ParseCategoriesFromFile(options.Providers)
+	if err != nil {
+		return nil, err
+	}
+	generateOptions := &generate.Options{Offline: options.Offline, SkipScrapers: true}
+	generateOptions.ParseFromEnv()
+	return categories.Compile(generateOptions)
+}
+
+// checkDataAge reports provider data older than maxAge. The client has its
+// own check, but warnings are hidden by default in the cli so the age is
+// reported at info level instead.
+func checkDataAge(info *cdncheck.Metadata, maxAge time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+	age, ok := info.Age()
+	switch {
+	case !ok:
+		gologger.Info().Msgf("Could not check age of provider data: generation time unknown")
+	case age > maxAge:
+		gologger.Info().Msgf("Provider data is %d days old, consider updating it", int(age.Hours()/24))
+	}
+}
+
+// replacedProviders returns the category:provider names of the embedded
+// providers whose ranges are replaced by the ones of the custom data
+func replacedProviders(embedded, custom *cdncheck.InputCompiled) []string {
+	var replaced []string
+	for _, category := range custom.CategoryNames() {
+		roots := make(map[string]struct{})
+		for name := range embedded.CategoryRanges(category) {
+			root, _ := cdncheck.SplitProviderPath(name)
+			roots[root] = struct{}{}
+		}
+		for name := range custom.CategoryRanges(category) {
+			root, _ := cdncheck.SplitProviderPath(name)
+			if _, ok := roots[root]; ok {
+				replaced = append(replaced, category+":"+root)
+				delete(roots, root)
+			}
+		}
+	}
+	slices.Sort(replaced)
+	return replaced
+}
+
 func (r *Runner) Run() error {
+	return r.RunContext(context.Background())
+}
+
+// RunContext is same as Run but stops processing inputs and aborts
+// in-flight lookups once ctx is cancelled
+func (r *Runner) RunContext(ctx context.Context) error {
 	err := r.configureOutput()
 	if err != nil {
 		return errors.Wrap(err, "could not configure output")
 	}
 	defer r.writer.Close()
+	if r.options.DataInfo {
+		r.writeDataInfo()
+		return nil
+	}
 	output := make(chan Output, 1)
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	go r.process(output, wg)
+	go r.process(ctx, output, wg)
 	wg.Add(1)
 	go r.waitForData(output, wg)
 	wg.Wait()
 	return nil
 }
 
+// writeDataInfo writes the metadata of the provider data
+func (r *Runner) writeDataInfo() {
+	info := r.cdnclient.DataInfo()
+	if info == nil {
+		gologger.Warning().Msgf("No metadata available for provider data")
+		return
+	}
+	if r.options.Json {
+		if data, err := json.Marshal(info); err == nil {
+			r.writer.Write(data)
+		}
+		return
+	}
+	generatedAt := "unknown"
+	if age, ok := info.Age(); ok {
+		generatedAt = fmt.Sprintf("%s (%d days ago)", info.GeneratedAt.Format(time.RFC3339), int(age.Hours()/24))
+	}
+	r.writer.WriteString(fmt.Sprintf("generated at %s by version %s", generatedAt, cmp.Or(info.Version, "unknown")))
+	for _, provider := range info.Providers {
+		sources := make([]string, 0, len(provider.Sources))
+		for _, source := range provider.Sources {
+			sources = append(sources, strings.TrimSpace(fmt.Sprintf("%s %s", source.Type, source.Source)))
+		}
+		if len(sources) == 0 {
+			sources = append(sources, "unknown sources")
+		}
+		r.writer.WriteString(fmt.Sprintf("[%s] [%s] %d prefixes from %s", provider.Category, provider.Provider, provider.Prefixes, strings.Join(sources, ", ")))
+	}
+}
+
 func (r *Runner) SetWriter(writer io.Writer) error {
 	outputWriter, err := NewOutputWriter()
 	if err != nil {
@@ -65,18 +243,21 @@ func (r *Runner) SetWriter(writer io.Writer) error {
 	return nil
 }
 
-func (r *Runner) process(output chan Output, wg *sync.WaitGroup) {
+func (r *Runner) process(ctx context.Context, output chan Output, wg *sync.WaitGroup) {
 	defer wg.Done()
 	defer close(output)
 	for _, target := range r.options.Inputs {
-		r.processInputItem(target, output)
+		if ctx.Err() != nil {
+			return
+		}
+		r.processInputItem(ctx, target, output)
 	}
 	if r.options.HasStdin {
 		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
+		for ctx.Err() == nil && scanner.Scan() {
 			text := scanner.Text()
 			if text != "" {
-				r.processInputItem(text, output)
+				r.processInputItem(ctx, text, output)
 			}
 		}
 	}
@@ -84,14 +265,12 @@ func (r *Runner) process(output chan Output, wg *sync.WaitGroup) {
 
 func (r *Runner) waitForData(output chan Output, wg *sync.WaitGroup) {
 	defer wg.Done()
-	var cdnCount, wafCount, cloudCount int
+	counts := make(map[string]int)
+	var total int
 	for receivedData := range output {
-		if receivedData.Cdn {
-			cdnCount++
-		} else if receivedData.Waf {
-			wafCount++
-		} else if receivedData.Cloud {
-			cloudCount++
+		if receivedData.Category != "" && !r.options.Exclude {
+			counts[receivedData.Category]++
+			total++
 		}
 
 		if r.options.OnResult != nil {
@@ -100,7 +279,7 @@ func (r *Runner) waitForData(output chan Output, wg *sync.WaitGroup) {
 
 		if r.options.Json {
 			r.writer.WriteJSON(receivedData)
-		} else if r.options.Response && !r.options.Exclude {
+		} else if (r.options.Response || r.options.ASN) && !r.options.Exclude {
 			r.writer.WriteString(receivedData.String())
 		} else {
 			r.writer.WriteString(receivedData.Input)
@@ -108,31 +287,18 @@ func (r *Runner) waitForData(output chan Output, wg *sync.WaitGroup) {
 	}
 
 	// show summary to user
-	sw := *r.aurora
-	if (cdnCount + wafCount + cloudCount) < 1 {
+	if total < 1 {
 		gologger.Info().Msgf("No results found.")
 		return
 	}
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("Found result: %v", (cdnCount + cloudCount + wafCount)))
-	builder.WriteString(" (")
-	if cdnCount > 0 {
-		builder.WriteString(fmt.Sprintf("%s %v", sw.BrightBlue("CDN:").String(), cdnCount))
-	}
-	if cloudCount > 0 {
-		if cdnCount > 0 {
-			builder.WriteString(", ")
-		}
-		builder.WriteString(fmt.Sprintf("%s %v", sw.BrightGreen("CLOUD:").String(), cloudCount))
-	}
-	if wafCount > 0 {
-		if cdnCount > 0 || cloudCount > 0 {
-			builder.WriteString(", ")
+	sw := *r.aurora
+	summary := make([]string, 0, len(counts))
+	for _, category := range r.cdnclient.Categories() {
+		if count := counts[category.Name]; count > 0 {
+			summary = append(summary, fmt.Sprintf("%s %v", colorCategory(sw, category.Name, strings.ToUpper(category.Name)+":"), count))
 		}
-		builder.WriteString(fmt.Sprintf("%s %v", sw.Yellow("WAF:").String(), wafCount))
 	}
-	builder.WriteString(")")
-	gologger.Info().Msg(builder.String())
+	gologger.Info().Msgf("Found result: %v (%s)", total, strings.Join(summary, ", "))
 }
 
 func (r *Runner) configureOutput() error {
@@ -160,7 +326,7 @@ func (r *Runner) configureOutput() error {
 }
 
 // processInputItem processes a single input item
-func (r *Runner) processInputItem(input string, output chan Output) {
+func (r *Runner) processInputItem(ctx context.Context, input string, output chan Output) {
 	// CIDR input
 	if _, ipRange, _ := net.ParseCIDR(input); ipRange != nil {
 		cidrInputs, err := mapcidr.IPAddressesAsStream(input)
@@ -171,46 +337,131 @@ func (r *Runner) processInputItem(input string, output chan Output) {
 			return
 		}
 		for cidr := range cidrInputs {
-			r.processInputItemSingle(cidr, output)
+			// keep draining the stream so its producer can exit
+			if ctx.Err() != nil {
+				continue
+			}
+			r.processInputItemSingle(ctx, cidr, output)
 		}
 	} else {
 		// Normal input
-		r.processInputItemSingle(input, output)
+		r.processInputItemSingle(ctx, input, output)
 	}
 }
 
-func (r *Runner) processInputItemSingle(item string, output chan Output) {
+func (r *Runner) processInputItemSingle(ctx context.Context, item string, output chan Output) {
 	data := Output{
-		aurora: r.aurora,
-		Input:  item,
+		aurora:  r.aurora,
+		Input:   item,
+		showASN: r.options.ASN,
 	}
 
-	var matched bool
-	var provider, itemType string
+	var result *cdncheck.Result
 	var err error
 
-	var targetIp string
 	if iputils.IsIP(item) {
-		matched, provider, itemType, err = r.cdnclient.Check(net.ParseIP(item))
-		targetIp = item
+		result, err = r.cdnclient.CheckResult(net.ParseIP(item))
 	} else {
-		matched, provider, itemType, err = r.cdnclient.CheckDomainWithFallback(item)
-		dnsData, err := r.cdnclient.GetDnsData(item)
-
-		if err == nil {
-			if len(dnsData.AAAA) > 0 {
-				targetIp = dnsData.AAAA[0]
-			} else if len(dnsData.A) > 0 {
-				targetIp = dnsData.A[0]
+		result, err = r.cdnclient.CheckDomainWithFallbackResultContext(ctx, item)
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		// lookups were aborted by the user
+		return
+	case errors.Is(err, context.DeadlineExceeded) && r.options.Verbose:
+		gologger.Error().Msgf("Timed out checking domain cdn %s: %s", item, err)
+	case err != nil && r.options.Verbose:
+		gologger.Error().Msgf("Could not check domain cdn %s: %s", item, err)
+	}
+	if result == nil {
+		result = &cdncheck.Result{Input: item}
+	}
+	var probeMatches []cdncheck.Match
+	if r.options.Probe {
+		probe, err := r.probe(ctx, item)
+		if err != nil && r.options.Verbose {
+			gologger.Error().Msgf("Could not probe %s: %s", item, err)
+		}
+		if match := r.mergeProbe(result, probe); match != nil {
+			probeMatches = append(probeMatches, *match)
+		}
+	}
+	if r.options.WAFProbe {
+		detection, err := r.cdnclient.DetectWAF(ctx, r.httpClient, probeURL(item, r.probePort))
+		if err != nil && r.options.Verbose {
+			gologger.Error().Msgf("Could not probe waf of %s: %s", item, err)
+		}
+		if detection != nil {
+			data.WAFProbe = &WAFProbe{
+				Vendor:  detection.Provider,
+				Blocked: detection.Blocked,
+				Payload: detection.Payload,
+				Status:  detection.Status,
+			}
+			if match := r.mergeProbe(result, &detection.Result); match != nil {
+				probeMatches = append(probeMatches, *match)
 			}
 		}
 	}
-	if err != nil && r.options.Verbose {
-		gologger.Error().Msgf("Could not check domain cdn %s: %s", item, err)
+	if r.options.TLS {
+		handshake, err := r.checkTLS(ctx, item)
+		if err != nil && r.options.Verbose {
+			gologger.Error().Msgf("Could not check tls of %s: %s", item, err)
+		}
+		if handshake != nil {
+			data.TLS = handshake.TLS
+			if match := r.mergeProbe(result, handshake); match != nil {
+				probeMatches = append(probeMatches, *match)
+			}
+		}
 	}
+	var nsMatch *cdncheck.Match
+	if r.options.NS && !iputils.IsIP(item) {
+		nameservers, err := r.cdnclient.CheckNSResultContext(ctx, item)
+		if err != nil && r.options.Verbose {
+			gologger.Error().Msgf("Could not check nameservers of %s: %s", item, err)
+		}
+		if nameservers != nil {
+			data.NS = nameservers.NS
+			if nameservers.Matched {
+				data.DNSProvider = nameservers.Provider
+				nsMatch = &cdncheck.Match{Category: nameservers.Category, Provider: nameservers.Provider}
+			}
+		}
+	}
+	matched, provider, itemType := result.Matched, result.Provider, result.Category
 
 	data.itemType = itemType
-	data.IP = targetIp
+	if len(result.IPs) > 0 {
+		data.IP = result.IPs[0]
+	}
+	data.Category = result.Category
+	data.Categories = result.Categories
+	data.Provider = result.Provider
+	data.ProviderID = result.ProviderID
+	data.Path = result.Path
+	if info, ok := r.cdnclient.Provider(result.Provider); ok && result.Provider != "" {
+		data.Tags = info.Tags
+	}
+	data.Prefix = result.Prefix
+	data.Suffix = result.Suffix
+	data.Method = result.Method
+	data.IPs = result.IPs
+	data.CNAMEs = result.CNAMEs
+	data.Chain = result.Chain
+	data.Fingerprint = result.Fingerprint
+	data.Matches = r.checkAll(result.IPs)
+	if nsMatch != nil {
+		probeMatches = append(probeMatches, *nsMatch)
+	}
+	for _, match := range probeMatches {
+		if !slices.Contains(data.Matches, match) {
+			data.Matches = append(data.Matches, match)
+		}
+	}
+	data.ASN = result.ASN
+	data.ASNOrg = result.ASNOrg
+	data.Country = result.Country
 	data.Timestamp = time.Now()
 
 	if r.options.Exclude {
@@ -220,98 +471,97 @@ func (r *Runner) processInputItemSingle(item string, output chan Output) {
 		return
 	}
 
-	switch itemType {
-	case "cdn":
-		data.Cdn = matched
-		data.CdnName = provider
-	case "cloud":
-		data.Cloud = matched
-		data.CloudName = provider
-	case "waf":
-		data.Waf = matched
-		data.WafName = provider
-	}
-	if skipped := filterIP(r.options, data); skipped {
+	categories := result.Categories
+	if len(categories) == 0 {
+		categories = []string{itemType}
+	}
+	for _, category := range categories {
+		switch category {
+		case "cdn":
+			data.Cdn = matched
+			data.CdnName = provider
+		case "cloud":
+			data.Cloud = matched
+			data.CloudName = provider
+		case "waf":
+			data.Waf = matched
+			data.WafName = provider
+		}
+	}
+	if skipped := r.filterIP(data); skipped {
 		return
 	}
-	if matched := matchIP(r.options, data); !matched {
+	if matched := r.matchIP(data); !matched {
 		return
 	}
-	switch {
-	case r.options.Cdn && data.itemType == "cdn", r.options.Cloud && data.itemType == "cloud", r.options.Waf && data.itemType == "waf":
-		{
+	display := r.options.displayCategories()
+	if len(display) == 0 {
+		// hosts matching no provider are kept for their asn, blocking waf
+		// or dns provider
+		if matched || data.ASN != 0 && (r.options.ASN || slices.Contains(r.matchASN, data.ASN)) || data.WAFProbe != nil && data.WAFProbe.Blocked || data.DNSProvider != "" {
 			output <- data
 		}
-	case (!r.options.Cdn && !r.options.Waf && !r.options.Cloud) && matched:
-		{
+		return
+	}
+	for _, category := range display {
+		if matched && data.hasCategory(category) || category == "dns" && data.DNSProvider != "" {
 			output <- data
+			return
 		}
 	}
 }
 
-func matchIP(options *Options, data Output) bool {
-	if len(options.MatchCdn) == 0 && len(options.MatchCloud) == 0 && len(options.MatchWaf) == 0 {
-		return true
-	}
-	if len(options.MatchCdn) > 0 && data.itemType == "cdn" {
-		matched := false
-		for _, filter := range options.MatchCdn {
-			if filter == data.CdnName {
-				matched = true
+// checkAll returns every provider match for the ips removing duplicates
+func (r *Runner) checkAll(ips []string) []cdncheck.Match {
+	var matches []cdncheck.Match
+	seen := make(map[cdncheck.Match]struct{})
+	for _, ip := range ips {
+		ipMatches, err := r.cdnclient.CheckAll(net.ParseIP(ip))
+		if err != nil {
+			if r.options.Verbose {
+				gologger.Error().Msgf("Could not check ip %s: %s", ip, err)
 			}
+			continue
 		}
-		if matched {
-			return true
-		}
-	}
-	if len(options.MatchCloud) > 0 && data.itemType == "cloud" {
-		matched := false
-		for _, filter := range options.MatchCloud {
-			if filter == data.CloudName {
-				matched = true
+		for _, match := range ipMatches {
+			if _, ok := seen[match]; ok {
+				continue
 			}
-		}
-		if matched {
-			return true
+			seen[match] = struct{}{}
+			matches = append(matches, match)
 		}
 	}
-	if len(options.MatchWaf) > 0 && data.itemType == "waf" {
-		matched := false
-		for _, filter := range options.MatchWaf {
-			if filter == data.WafName {
-				matched = true
-			}
-		}
-		if matched {
-			return true
-		}
+	return matches
+}
+
+// matchIP returns true if the output matches the match flags, provider
+// names being matched by id, alias or parent in the registry and by
+// leading segments of their service and region path
+func (r *Runner) matchIP(data Output) bool {
+	filters := r.options.matchProviders()
+	if len(filters) == 0 && len(r.matchASN) == 0 {
+		return true
 	}
-	return false
+	return r.matchProviders(data, filters) || slices.Contains(r.matchASN, data.ASN)
+}
+
+// filterIP returns true if the output matches the filter flags
+func (r *Runner) filterIP(data Output) bool {
+	return r.matchProviders(data, r.options.filterProviders()) || slices.Contains(r.filterASN, data.ASN)
 }
 
-func filterIP(options *Options, data Output) bool {
-	if len(options.FilterCdn) == 0 && len(options.FilterCloud) == 0 && len(options.FilterWaf) == 0 {
+// matchProviders returns true if the provider of the output is one of
+// the providers of a category it is reported as
+func (r *Runner) matchProviders(data Output, filters map[string][]string) bool {
+	if data.Provider == "" {
 		return false
 	}
-	if len(options.FilterCdn) > 0 && data.itemType == "cdn" {
-		for _, filter := range options.FilterCdn {
-			if filter == data.CdnName {
-				return true
-			}
-		}
-	}
-	if len(options.FilterCloud) > 0 && data.itemType == "cloud" {
-		for _, filter := range options.FilterCloud {
-			if filter == data.CloudName {
-				return true
-			}
+	for category, providers := range filters {
+		if category != "" && !data.hasCategory(category) {
+			continue
 		}
-	}
-	if len(options.FilterWaf) > 0 && data.itemType == "waf" {
-		for _, filter := range options.FilterWaf {
-			if filter == data.WafName {
-				return true
-			}
+		if r.cdnclient.MatchProvider(cmp.Or(data.Path, data.Provider), providers...) {
+			return true
 		}
 	}
 	return false
@@ -0,0 +1,263 @@
+package runner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/miekg/dns"
+	"github.com/projectdiscovery/cdncheck"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDNSServer starts a local dns server answering with the records
+// provided in zone file format and returns its address
+func newTestDNSServer(t *testing.T, records ...string) string {
+	t.Helper()
+
+	var rrs []dns.RR
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		require.Nil(t, err, "could not parse record %s", record)
+		rrs = append(rrs, rr)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "could not listen")
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		for _, rr := range rrs {
+			if strings.EqualFold(rr.Header().Name, req.Question[0].Name) && rr.Header().Rrtype == req.Question[0].Qtype {
+				msg.Answer = append(msg.Answer, rr)
+			}
+		}
+		if len(msg.Answer) == 0 {
+			msg.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(msg)
+	})}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	return conn.LocalAddr().String()
+}
+
+// newTestRunner returns a runner checking hosts against the data, resolving
+// them with the resolver and probing them on the port of server
+func newTestRunner(t *testing.T, options *Options, data *cdncheck.InputCompiled, resolver string, server *httptest.Server) *Runner {
+	t.Helper()
+
+	client, err := cdncheck.NewClient(cdncheck.WithData(data), cdncheck.WithResolvers(resolver), cdncheck.WithMaxRetries(1))
+	require.Nil(t, err, "could not create client")
+	if options.ProbeTimeout == 0 {
+		options.ProbeTimeout = 5
+	}
+	standardWriter := aurora.NewAurora(false)
+	runner := &Runner{
+		options:    options,
+		cdnclient:  client,
+		aurora:     &standardWriter,
+		httpClient: newProbeClient(time.Duration(options.ProbeTimeout) * time.Second),
+		probePort:  "443",
+	}
+	if server != nil {
+		_, runner.probePort, err = net.SplitHostPort(server.Listener.Addr().String())
+		require.Nil(t, err, "could not get port of server")
+	}
+	return runner
+}
+
+// process returns the outputs of processing a single item
+func process(r *Runner, item string) []Output {
+	output := make(chan Output, 1)
+	r.processInputItemSingle(context.Background(), item, output)
+	close(output)
+	var outputs []Output
+	for data := range output {
+		outputs = append(outputs, data)
+	}
+	return outputs
+}
+
+// edgeServer returns a tls server answering with the headers of the edge
+// provider and blocking the requests carrying a query like the shield waf
+func edgeServer(t *testing.T, block bool) *httptest.Server {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Edge", "1")
+		if block && r.URL.RawQuery != "" {
+			w.Header().Set("X-Shield", "1")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("blocked by shield"))
+			return
+		}
+		_, _ = w.Write([]byte("<html><body>welcome</body></html>"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProcessProbe(t *testing.T) {
+	resolver := newTestDNSServer(t)
+	server := edgeServer(t, false)
+	fingerprints := map[string][]cdncheck.HTTPFingerprint{"edge": {{Header: "X-Edge"}}}
+	categories := map[string][]string{"edge": {"cdn", "waf"}}
+
+	// the fingerprint of the provider of the ip is kept as evidence
+	runner := newTestRunner(t, &Options{Probe: true}, &cdncheck.InputCompiled{
+		CDN:                   map[string][]string{"edge": {"127.0.0.1/32"}},
+		Fingerprints:          fingerprints,
+		FingerprintCategories: categories,
+	}, resolver, server)
+	outputs := process(runner, "127.0.0.1")
+	require.Len(t, outputs, 1, "could not get output of probed host")
+	require.Equal(t, "edge", outputs[0].Provider, "could not keep provider of ip")
+	require.Equal(t, cdncheck.DetectionMethodIP, outputs[0].Method, "could not keep detection method of ip")
+	require.Equal(t, "header:x-edge", outputs[0].Fingerprint, "could not get fingerprint")
+	require.Equal(t, []string{"cdn", "waf"}, outputs[0].Categories, "could not merge categories of fingerprint")
+	require.True(t, outputs[0].Cdn && outputs[0].Waf, "could not flag categories of fingerprint")
+
+	// an unmatched host takes the provider of the fingerprint
+	runner = newTestRunner(t, &Options{Probe: true}, &cdncheck.InputCompiled{
+		Fingerprints:          fingerprints,
+		FingerprintCategories: categories,
+	}, resolver, server)
+	outputs = process(runner, "127.0.0.1")
+	require.Len(t, outputs, 1, "could not get output of probed host")
+	require.Equal(t, "edge", outputs[0].Provider, "could not get provider of fingerprint")
+	require.Equal(t, cdncheck.DetectionMethodHTTP, outputs[0].Method, "could not get detection method of fingerprint")
+
+	// the fingerprint of another provider is added to the matches
+	runner = newTestRunner(t, &Options{Probe: true}, &cdncheck.InputCompiled{
+		Cloud:                 map[string][]string{"racks": {"127.0.0.1/32"}},
+		Fingerprints:          fingerprints,
+		FingerprintCategories: categories,
+	}, resolver, server)
+	outputs = process(runner, "127.0.0.1")
+	require.Len(t, outputs, 1, "could not get output of probed host")
+	require.Equal(t, "racks", outputs[0].Provider, "could not keep provider of ip")
+	require.Empty(t, outputs[0].Fingerprint, "could attribute fingerprint of another provider")
+	require.Contains(t, outputs[0].Matches, cdncheck.Match{Category: "cdn", Provider: "edge"}, "could not add provider of fingerprint to matches")
+
+	// hosts are not requested without -probe
+	runner.options.Probe = false
+	outputs = process(runner, "127.0.0.1")
+	require.Len(t, outputs, 1, "could not get output of host")
+	require.NotContains(t, outputs[0].Matches, cdncheck.Match{Category: "cdn", Provider: "edge"}, "could probe host without -probe")
+}
+
+func TestProcessWAFProbe(t *testing.T) {
+	resolver := newTestDNSServer(t)
+	data := &cdncheck.InputCompiled{
+		BlockFingerprints: map[string][]cdncheck.HTTPFingerprint{"shield": {{Header: "X-Shield", Status: []int{403}}}},
+	}
+
+	runner := newTestRunner(t, &Options{WAFProbe: true}, data, resolver, edgeServer(t, true))
+	outputs := process(runner, "127.0.0.1")
+	require.Len(t, outputs, 1, "could not get output of blocking host")
+	require.NotNil(t, outputs[0].WAFProbe, "could not get waf probe")
+	require.Equal(t, "shield", outputs[0].WAFProbe.Vendor, "could not get waf vendor")
+	require.True(t, outputs[0].WAFProbe.Blocked, "could not observe blocking")
+	require.Equal(t, http.StatusForbidden, outputs[0].WAFProbe.Status, "could not get blocked status")
+	require.Equal(t, "shield", outputs[0].Provider, "could not take provider of block page")
+	require.True(t, outputs[0].Waf, "could not flag waf of block page")
+
+	// a host which does not block and matches no provider is not displayed
+	runner = newTestRunner(t, &Options{WAFProbe: true}, data, resolver, edgeServer(t, false))
+	require.Empty(t, process(runner, "127.0.0.1"), "could display host without waf")
+}
+
+func TestProcessTLS(t *testing.T) {
+	resolver := newTestDNSServer(t)
+	// certificates of httptest servers are issued by Acme Co
+	runner := newTestRunner(t, &Options{TLS: true}, &cdncheck.InputCompiled{
+		TLSIssuers:    map[string][]string{"acme": {"^Acme Co"}},
+		TLSCategories: map[string][]string{"acme": {"cloud"}},
+	}, resolver, edgeServer(t, false))
+
+	outputs := process(runner, "127.0.0.1")
+	require.Len(t, outputs, 1, "could not get output of tls host")
+	require.Equal(t, "acme", outputs[0].Provider, "could not get provider of issuer")
+	require.Equal(t, cdncheck.DetectionMethodTLS, outputs[0].Method, "could not get detection method of issuer")
+	require.True(t, outputs[0].Cloud, "could not flag category of issuer")
+	require.NotNil(t, outputs[0].TLS, "could not get handshake")
+	require.Equal(t, "Acme Co", outputs[0].TLS.IssuerOrg, "could not get issuer organization")
+
+	runner.options.TLS = false
+	require.Empty(t, process(runner, "127.0.0.1"), "could connect to host without -tls")
+}
+
+func TestProcessNS(t *testing.T) {
+	resolver := newTestDNSServer(t,
+		"example.com. 60 IN NS ns1.edgedns.net.",
+		"example.com. 60 IN NS ns2.edgedns.net.",
+		"www.example.com. 60 IN A 192.0.2.10",
+	)
+	data := &cdncheck.InputCompiled{Nameservers: map[string][]string{"edgedns": {"edgedns.net"}}}
+
+	runner := newTestRunner(t, &Options{NS: true}, data, resolver, nil)
+	outputs := process(runner, "www.example.com")
+	require.Len(t, outputs, 1, "could not display host with dns provider")
+	require.Equal(t, "edgedns", outputs[0].DNSProvider, "could not get dns provider")
+	require.ElementsMatch(t, []string{"ns1.edgedns.net", "ns2.edgedns.net"}, outputs[0].NS, "could not get nameservers")
+	require.Empty(t, outputs[0].Provider, "could report dns provider as provider of host")
+	require.Contains(t, outputs[0].Matches, cdncheck.Match{Category: "dns", Provider: "edgedns"}, "could not add dns provider to matches")
+
+	runner = newTestRunner(t, &Options{NS: true, Categories: []string{"dns"}}, data, resolver, nil)
+	require.Len(t, process(runner, "www.example.com"), 1, "could not display dns category")
+	runner = newTestRunner(t, &Options{NS: true, Cdn: true}, data, resolver, nil)
+	require.Empty(t, process(runner, "www.example.com"), "could display dns provider for cdn category")
+	runner = newTestRunner(t, &Options{}, data, resolver, nil)
+	require.Empty(t, process(runner, "www.example.com"), "could resolve nameservers without -ns")
+}
+
+func TestProcessMatchFilter(t *testing.T) {
+	resolver := newTestDNSServer(t)
+	data := &cdncheck.InputCompiled{
+		CDN:      map[string][]string{"edge/eu/west": {"127.0.0.1/32"}},
+		Registry: []cdncheck.ProviderInfo{{ID: "edge-cdn", Aliases: []string{"edge"}}},
+	}
+	tests := []struct {
+		name     string
+		options  *Options
+		expected bool
+	}{
+		{name: "id", options: &Options{MatchCdn: []string{"edge-cdn"}}, expected: true},
+		{name: "alias", options: &Options{MatchProviders: []string{"cdn:EDGE"}}, expected: true},
+		{name: "path", options: &Options{MatchCdn: []string{"edge-cdn/eu"}}, expected: true},
+		{name: "other path", options: &Options{MatchCdn: []string{"edge/us"}}},
+		{name: "other category", options: &Options{MatchWaf: []string{"edge"}}},
+		{name: "filter id", options: &Options{FilterCdn: []string{"edge-cdn"}}},
+		{name: "filter other path", options: &Options{FilterProviders: []string{"edge/us"}}, expected: true},
+		{name: "display category", options: &Options{Cdn: true}, expected: true},
+		{name: "display other category", options: &Options{Cloud: true}},
+	}
+	for _, test := range tests {
+		runner := newTestRunner(t, test.options, data, resolver, nil)
+		outputs := process(runner, "127.0.0.1")
+		require.Equal(t, test.expected, len(outputs) == 1, "could not match %s", test.name)
+		if test.expected {
+			require.Equal(t, "edge-cdn", outputs[0].ProviderID, "could not get provider id with %s", test.name)
+			require.Equal(t, "edge/eu/west", outputs[0].Path, "could not get path with %s", test.name)
+		}
+	}
+}
+
+func TestReplacedProviders(t *testing.T) {
+	embedded := &cdncheck.InputCompiled{
+		CDN: map[string][]string{"cloudflare": {"173.245.48.0/20"}, "fastly/eu": {"151.101.0.0/16"}},
+		WAF: map[string][]string{"incapsula": {"45.60.0.0/16"}},
+	}
+	custom := &cdncheck.InputCompiled{
+		CDN:   map[string][]string{"fastly": {"192.0.2.0/24"}, "internal": {"198.51.100.0/24"}},
+		Cloud: map[string][]string{"cloudflare": {"203.0.113.0/24"}},
+	}
+	require.Equal(t, []string{"cdn:fastly"}, replacedProviders(embedded, custom), "could not get replaced providers")
+}
@@ -0,0 +1,147 @@
+package cdncheck
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SourceType is the kind of source the ranges of a provider came from
+type SourceType string
+
+const (
+	// SourceTypeCIDR is used for static ranges listed in provider.yaml
+	SourceTypeCIDR SourceType = "cidr"
+	// SourceTypeURL is used for ranges scraped from an url
+	SourceTypeURL SourceType = "url"
+	// SourceTypeASN is used for ranges of an ASN fetched from ipinfo
+	SourceTypeASN SourceType = "asn"
+	// SourceTypeScraper is used for ranges fetched by a custom scraper
+	SourceTypeScraper SourceType = "scraper"
+	// SourceTypeFeed is used for ranges parsed from a structured feed
+	// along with the services and regions they belong to
+	SourceTypeFeed SourceType = "feed"
+)
+
+// Metadata describes when and how compiled data was generated
+type Metadata struct {
+	// GeneratedAt is the time the data was generated, zero if unknown
+	GeneratedAt time.Time `yaml:"generated_at,omitempty" json:"generated_at,omitzero"`
+	// Version is the version of the tool which generated the data
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	// Providers contains the sources of the ranges of each provider
+	Providers []ProviderMetadata `yaml:"providers,omitempty" json:"providers,omitempty"`
+}
+
+// ProviderMetadata describes where the ranges of a provider came from
+type ProviderMetadata struct {
+	// Category is the category of the provider (cdn, waf, cloud)
+	Category string `yaml:"category" json:"category"`
+	// Provider is the name of the provider
+	Provider string `yaml:"provider" json:"provider"`
+	// Prefixes is the number of prefixes of the provider in the data
+	Prefixes int `yaml:"prefixes" json:"prefixes"`
+	// Sources contains the sources the ranges were fetched from
+	Sources []SourceMetadata `yaml:"sources,omitempty" json:"sources,omitempty"`
+}
+
+// SourceMetadata describes a single source of ranges of a provider
+type SourceMetadata struct {
+	// Type is the kind of the source
+	Type SourceType `yaml:"type" json:"type"`
+	// Source is the url, ASN or scraper name of the source
+	Source string `yaml:"source,omitempty" json:"source,omitempty"`
+	// FetchedAt is the time the ranges were fetched, zero for static ranges
+	FetchedAt time.Time `yaml:"fetched_at,omitempty" json:"fetched_at,omitzero"`
+	// Prefixes is the number of prefixes the source returned
+	Prefixes int `yaml:"prefixes" json:"prefixes"`
+}
+
+// Age returns the time elapsed since the data was generated, or
+// false if the generation time is unknown
+func (m *Metadata) Age() (time.Duration, bool) {
+	if m == nil || m.GeneratedAt.IsZero() {
+		return 0, false
+	}
+	return time.Since(m.GeneratedAt), true
+}
+
+// SortProviders sorts the providers by category check order and name
+func (m *Metadata) SortProviders() {
+	slices.SortFunc(m.Providers, func(a, b ProviderMetadata) int {
+		return cmp.Or(
+			categoryOrder(a.Category)-categoryOrder(b.Category),
+			strings.Compare(a.Category, b.Category),
+			strings.Compare(a.Provider, b.Provider),
+		)
+	})
+}
+
+// mergeMetadata layers the metadata of data sources, keeping the oldest
+// generation time and the provider entries of the later layers. The
+// generation time is unknown if any layer lacks one, so fresher layers
+// cannot hide the age of older data.
+func mergeMetadata(layers ...*InputCompiled) *Metadata {
+	var merged *Metadata
+	var unknown bool
+	for _, layer := range layers {
+		if layer.Metadata == nil || layer.Metadata.GeneratedAt.IsZero() {
+			unknown = true
+		}
+		if layer.Metadata == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &Metadata{}
+		}
+		if generatedAt := layer.Metadata.GeneratedAt; !generatedAt.IsZero() && (merged.GeneratedAt.IsZero() || generatedAt.Before(merged.GeneratedAt)) {
+			merged.GeneratedAt = generatedAt
+		}
+		if layer.Metadata.Version != "" {
+			merged.Version = layer.Metadata.Version
+		}
+		for _, provider := range layer.Metadata.Providers {
+			merged.Providers = slices.DeleteFunc(merged.Providers, func(item ProviderMetadata) bool {
+				return item.Category == provider.Category && item.Provider == provider.Provider
+			})
+			merged.Providers = append(merged.Providers, provider)
+		}
+	}
+	if merged != nil {
+		if unknown {
+			merged.GeneratedAt = time.Time{}
+		}
+		merged.SortProviders()
+	}
+	return merged
+}
+
+// DataInfo returns the metadata of the provider data loaded by the client,
+// or nil if none of its data sources has any
+func (c *Client) DataInfo() *Metadata {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.loaded.Metadata == nil {
+		return nil
+	}
+	info := *c.loaded.Metadata
+	info.Providers = slices.Clone(info.Providers)
+	return &info
+}
+
+// checkDataAge warns if the loaded data is older than the maximum age
+func (c *Client) checkDataAge() {
+	if c.options.maxDataAge <= 0 {
+		return
+	}
+	age, ok := c.loaded.Metadata.Age()
+	if !ok {
+		c.logger.Warning().Msgf("Could not check age of provider data: generation time unknown")
+		return
+	}
+	if age > c.options.maxDataAge {
+		c.logger.Warning().Msgf("Provider data is %d days old, consider updating it", int(age.Hours()/24))
+	}
+}
@@ -0,0 +1,280 @@
+package cdncheck
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+	"github.com/pkg/errors"
+)
+
+// mmdbDatabase is a database in the MaxMind DB format, such as the GeoLite2
+// ASN and Country databases or the ipinfo ones
+type mmdbDatabase struct {
+	path   string
+	reader *maxminddb.Reader
+}
+
+// openMMDB reads a MaxMind DB format database into memory
+func openMMDB(path string) (*mmdbDatabase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read mmdb database %s", path)
+	}
+	reader, err := maxminddb.OpenBytes(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open mmdb database %s", path)
+	}
+	return &mmdbDatabase{path: path, reader: reader}, nil
+}
+
+// mmdbRecord is the country and autonomous system of an ip found in the
+// mmdb databases
+type mmdbRecord struct {
+	country string
+	asn     ASNInfo
+}
+
+// lookupMMDB returns the record of an address, each field being taken from
+// the first database having it
+func lookupMMDB(databases []*mmdbDatabase, addr netip.Addr) (mmdbRecord, bool) {
+	var record mmdbRecord
+	found := false
+	for _, database := range databases {
+		result := database.reader.Lookup(addr)
+		if !result.Found() {
+			continue
+		}
+		var fields map[string]any
+		if err := result.Decode(&fields); err != nil {
+			continue
+		}
+		if record.country == "" {
+			record.country = mmdbCountry(fields)
+		}
+		if record.asn.Number == 0 {
+			if number := mmdbASN(fields); number != 0 {
+				record.asn = ASNInfo{Number: number, Org: mmdbOrg(fields), Prefix: result.Prefix().String()}
+			}
+		}
+		found = found || record.country != "" || record.asn.Number != 0
+	}
+	return record, found
+}
+
+// mmdbCountry returns the iso code of the country of a record, in the
+// MaxMind layout or the flat one of ipinfo
+func mmdbCountry(fields map[string]any) string {
+	if code, ok := fields["country_code"].(string); ok {
+		return code
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		switch value := fields[key].(type) {
+		case map[string]any:
+			if code, ok := value["iso_code"].(string); ok {
+				return code
+			}
+		case string:
+			// ipinfo databases without a country_code field keep the code here
+			if len(value) == 2 {
+				return strings.ToUpper(value)
+			}
+		}
+	}
+	return ""
+}
+
+// mmdbASN returns the autonomous system number of a record, given either
+// as a number or as a string in the AS13335 form
+func mmdbASN(fields map[string]any) uint32 {
+	for _, key := range []string{"autonomous_system_number", "asn"} {
+		switch value := fields[key].(type) {
+		case uint64:
+			if value <= 1<<32-1 {
+				return uint32(value)
+			}
+		case uint32:
+			return value
+		case string:
+			if number, err := ParseASN(value); err == nil {
+				return number
+			}
+		}
+	}
+	return 0
+}
+
+// mmdbOrg returns the organization operating the autonomous system of a record
+func mmdbOrg(fields map[string]any) string {
+	for _, key := range []string{"autonomous_system_organization", "as_name"} {
+		if org, ok := fields[key].(string); ok {
+			return org
+		}
+	}
+	return ""
+}
+
+// ASNRule attributes the ips announced by autonomous systems to a provider
+// of a category, e.g. all of AS13335 to the cloudflare waf. Rules apply to
+// ips matching no ranges of the data, with the autonomous system found in
+// the ip to asn table of the data or in the mmdb databases of the client.
+type ASNRule struct {
+	// Category is the category of the provider
+	Category string `yaml:"category" json:"category"`
+	// Provider is the name of the provider
+	Provider string `yaml:"provider" json:"provider"`
+	// ASN contains the numbers of the autonomous systems of the provider
+	ASN []uint32 `yaml:"asn,omitempty" json:"asn,omitempty"`
+	// Orgs contains case insensitive parts of the names of the organizations
+	// of the provider, e.g. cloudflare for Cloudflare, Inc.
+	Orgs []string `yaml:"orgs,omitempty" json:"orgs,omitempty"`
+}
+
+// validate validates the fields of the rule
+func (r ASNRule) validate() error {
+	if r.Category == "" || r.Provider == "" {
+		return errors.New("asn rule category and provider cannot be empty")
+	}
+	if len(r.ASN) == 0 && len(r.Orgs) == 0 {
+		return fmt.Errorf("asn rule for %s has no asn or organization", r.Provider)
+	}
+	for _, org := range r.Orgs {
+		if strings.TrimSpace(org) == "" {
+			return fmt.Errorf("asn rule for %s has an empty organization", r.Provider)
+		}
+	}
+	return nil
+}
+
+// match returns true if the autonomous system is one of the rule
+func (r ASNRule) match(info ASNInfo) bool {
+	for _, number := range r.ASN {
+		if number == info.Number {
+			return true
+		}
+	}
+	if info.Org == "" {
+		return false
+	}
+	org := strings.ToLower(info.Org)
+	for _, value := range r.Orgs {
+		if strings.Contains(org, strings.ToLower(strings.TrimSpace(value))) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupASN returns the autonomous system of an address in the ip to asn
+// table of the index, or in the mmdb databases of the client
+func (c *Client) lookupASN(index *dataIndex, addr netip.Addr) (ASNInfo, bool) {
+	if info, ok := index.asn.lookup(addr); ok {
+		return info, true
+	}
+	if record, ok := lookupMMDB(c.options.mmdb, addr); ok && record.asn.Number != 0 {
+		return record.asn, true
+	}
+	return ASNInfo{}, false
+}
+
+// matchASNRule returns the first rule of an enabled category matching the
+// autonomous system, restricted to a category if one is specified
+func (c *Client) matchASNRule(info ASNInfo, category string) (ASNRule, bool) {
+	for _, rule := range c.options.asnRules {
+		if category != "" && rule.Category != category || !c.options.enabled(rule.Category) {
+			continue
+		}
+		if rule.match(info) {
+			return rule, true
+		}
+	}
+	return ASNRule{}, false
+}
+
+// asnRuleMatches returns a match for every provider of an enabled category
+// whose rules match the autonomous system of an address
+func (c *Client) asnRuleMatches(index *dataIndex, addr netip.Addr) []Match {
+	if len(c.options.asnRules) == 0 {
+		return nil
+	}
+	info, ok := c.lookupASN(index, addr)
+	if !ok {
+		return nil
+	}
+	var matches []Match
+	for _, rule := range c.options.asnRules {
+		if !c.options.enabled(rule.Category) || !rule.match(info) {
+			continue
+		}
+		match := Match{Category: rule.Category, Provider: rule.Provider, Prefix: info.Prefix}
+		if !slices.Contains(matches, match) {
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// checkASNRules returns the rule matching the autonomous system of an
+// address, restricted to a category if one is specified
+func (c *Client) checkASNRules(index *dataIndex, addr netip.Addr, category string) (ASNRule, bool) {
+	if len(c.options.asnRules) == 0 {
+		return ASNRule{}, false
+	}
+	info, ok := c.lookupASN(index, addr)
+	if !ok {
+		return ASNRule{}, false
+	}
+	return c.matchASNRule(info, category)
+}
+
+// enrich sets the country and the autonomous system of the first ip of the
+// result found in the mmdb databases, the autonomous system of the ip to asn
+// table of the data being kept if the result has one
+func (c *Client) enrich(result *Result, ips ...string) {
+	if len(c.options.mmdb) == 0 {
+		return
+	}
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		record, ok := lookupMMDB(c.options.mmdb, addr.Unmap())
+		if !ok {
+			continue
+		}
+		result.Country = record.country
+		if result.ASN == 0 {
+			result.ASN, result.ASNOrg = record.asn.Number, record.asn.Org
+		} else if result.ASNOrg == "" && result.ASN == record.asn.Number {
+			result.ASNOrg = record.asn.Org
+		}
+		return
+	}
+}
+
+// checkResult returns the result of checking an ip against the index,
+// enriched with the mmdb databases and attributed by the asn rules of the
+// client if the ranges of the data have no provider for it
+func (c *Client) checkResult(index *dataIndex, ip net.IP) (*Result, error) {
+	result, err := index.checkResult(ip)
+	if err != nil {
+		return nil, err
+	}
+	c.enrich(result, result.Input)
+	if result.Matched || result.ASN == 0 {
+		return index.identify(result), nil
+	}
+	if rule, ok := c.matchASNRule(ASNInfo{Number: result.ASN, Org: result.ASNOrg}, ""); ok {
+		result.Matched = true
+		result.Category = rule.Category
+		result.Categories = []string{rule.Category}
+		result.Provider = rule.Provider
+		result.Method = DetectionMethodASN
+	}
+	return index.identify(result), nil
+}
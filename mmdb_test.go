@@ -0,0 +1,121 @@
+package cdncheck
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestMMDB writes a database with a record for each network
+func writeTestMMDB(t *testing.T, records map[string]mmdbtype.Map) string {
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "cdncheck-test", IncludeReservedNetworks: true})
+	require.Nil(t, err, "could not create mmdb tree")
+	for cidr, record := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		require.Nil(t, err, "could not parse network")
+		require.Nil(t, tree.Insert(network, record), "could not insert network")
+	}
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	file, err := os.Create(path)
+	require.Nil(t, err, "could not create mmdb file")
+	defer func() {
+		_ = file.Close()
+	}()
+	_, err = tree.WriteTo(file)
+	require.Nil(t, err, "could not write mmdb file")
+	return path
+}
+
+func TestClientMMDB(t *testing.T) {
+	// GeoLite2 ASN and Country layout
+	asnDatabase := writeTestMMDB(t, map[string]mmdbtype.Map{
+		"192.0.2.0/24": {
+			"autonomous_system_number":       mmdbtype.Uint32(64500),
+			"autonomous_system_organization": mmdbtype.String("Edge Networks, Inc."),
+		},
+		"198.51.100.0/24": {
+			"autonomous_system_number":       mmdbtype.Uint32(64501),
+			"autonomous_system_organization": mmdbtype.String("Example Hosting"),
+		},
+	})
+	countryDatabase := writeTestMMDB(t, map[string]mmdbtype.Map{
+		"192.0.2.0/23": {"country": mmdbtype.Map{"iso_code": mmdbtype.String("DE")}},
+	})
+	// ipinfo layout
+	ipinfoDatabase := writeTestMMDB(t, map[string]mmdbtype.Map{
+		"203.0.113.0/24": {
+			"country": mmdbtype.String("jp"),
+			"asn":     mmdbtype.String("AS64502"),
+			"as_name": mmdbtype.String("Example Transit"),
+		},
+	})
+
+	client, err := NewClient(
+		WithData(&InputCompiled{CDN: map[string][]string{"edge": {"192.0.2.0/25"}}}),
+		WithMMDB(asnDatabase, countryDatabase, ipinfoDatabase),
+		WithASNRules(
+			ASNRule{Category: "waf", Provider: "edge", Orgs: []string{"edge networks"}},
+			ASNRule{Category: "cloud", Provider: "example-hosting", ASN: []uint32{64501}},
+		),
+	)
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckResult(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Equal(t, "cdn", result.Category, "could not keep range match over asn rule")
+	require.Equal(t, DetectionMethodIP, result.Method, "could not keep range match over asn rule")
+	require.Equal(t, uint32(64500), result.ASN, "could not enrich asn")
+	require.Equal(t, "Edge Networks, Inc.", result.ASNOrg, "could not enrich asn org")
+	require.Equal(t, "DE", result.Country, "could not enrich country")
+
+	result, err = client.CheckResult(net.ParseIP("192.0.2.200"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, result.Matched, "could not match asn rule by organization")
+	require.Equal(t, "waf", result.Category, "could not get asn rule category")
+	require.Equal(t, "edge", result.Provider, "could not get asn rule provider")
+	require.Equal(t, DetectionMethodASN, result.Method, "could not get asn detection method")
+
+	matched, provider, category, err := client.Check(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, matched, "could not match asn rule by number")
+	require.Equal(t, "example-hosting", provider, "could not get asn rule provider")
+	require.Equal(t, "cloud", category, "could not get asn rule category")
+
+	matched, _, err = client.CheckWAF(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check waf")
+	require.False(t, matched, "could match asn rule of another category")
+	matched, provider, err = client.CheckCloud(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check cloud")
+	require.True(t, matched, "could not match asn rule of category")
+	require.Equal(t, "example-hosting", provider, "could not get asn rule provider")
+
+	matches, err := client.CheckAll(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check all providers")
+	require.Equal(t, []Match{{Category: "cloud", Provider: "example-hosting", Prefix: "198.51.100.0/24"}}, matches, "could not match asn rule in all providers")
+	matches, err = client.CheckAll(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check all providers")
+	require.Equal(t, []Match{{Category: "cdn", Provider: "edge", Prefix: "192.0.2.0/25"}}, matches, "could not keep range matches over asn rules")
+
+	result, err = client.CheckResult(net.ParseIP("203.0.113.9"))
+	require.Nil(t, err, "could not check ip")
+	require.False(t, result.Matched, "could match ip without rule")
+	require.Equal(t, uint32(64502), result.ASN, "could not enrich ipinfo asn")
+	require.Equal(t, "Example Transit", result.ASNOrg, "could not enrich ipinfo asn org")
+	require.Equal(t, "JP", result.Country, "could not enrich ipinfo country")
+
+	info, ok := client.LookupASN(net.ParseIP("203.0.113.9"))
+	require.True(t, ok, "could not lookup asn in mmdb")
+	require.Equal(t, "203.0.113.0/24", info.Prefix, "could not get mmdb network")
+
+	_, err = NewClient(WithData(&InputCompiled{}), WithASNRules(ASNRule{Category: "dns", Provider: "edge", ASN: []uint32{1}}))
+	require.NotNil(t, err, "could create client with asn rule of unknown category")
+	_, err = NewClient(WithData(&InputCompiled{}), WithASNRules(ASNRule{Category: "cdn", Provider: "edge"}))
+	require.NotNil(t, err, "could create client with empty asn rule")
+	_, err = NewClient(WithData(&InputCompiled{}), WithMMDB(filepath.Join(t.TempDir(), "missing.mmdb")))
+	require.NotNil(t, err, "could create client with missing mmdb database")
+}
@@ -0,0 +1,170 @@
+package cdncheck
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// defaultNameserverCategory is the category of nameservers declared
+// without one
+const defaultNameserverCategory = "dns"
+
+// nameserverMatch is a nameserver pattern of a provider along with the
+// categories it is reported as
+type nameserverMatch struct {
+	provider   string
+	pattern    string
+	labels     []string
+	categories []string
+}
+
+// nameservers returns the nameserver patterns of the data with their
+// enabled categories sorted by provider, skipping the invalid ones
+func (o *clientOptions) nameservers(data *InputCompiled, providers map[string]map[string]*customProvider) []*nameserverMatch {
+	var matches []*nameserverMatch
+	for _, provider := range slices.Sorted(maps.Keys(data.Nameservers)) {
+		categories := o.providerCategories(provider, data.NameserverCategories[provider], defaultNameserverCategory, providers)
+		if len(categories) == 0 {
+			continue
+		}
+		for _, pattern := range data.Nameservers[provider] {
+			pattern = normalizeSuffix(pattern)
+			if ValidateNameserverPattern(pattern) != nil {
+				continue
+			}
+			matches = append(matches, &nameserverMatch{
+				provider:   provider,
+				pattern:    pattern,
+				labels:     strings.Split(pattern, "."),
+				categories: categories,
+			})
+		}
+	}
+	return matches
+}
+
+// ValidateNameserverPattern returns an error if a nameserver pattern has
+// an empty label or an invalid wildcard
+func ValidateNameserverPattern(pattern string) error {
+	for _, label := range strings.Split(normalizeSuffix(pattern), ".") {
+		if label == "" {
+			return fmt.Errorf("nameserver pattern %q has an empty label", pattern)
+		}
+		if _, err := path.Match(label, ""); err != nil {
+			return fmt.Errorf("invalid nameserver pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// match returns true if the last labels of the nameserver match the
+// labels of the pattern, a label of the pattern possibly containing *
+// wildcards, e.g. awsdns-*.com
+func (m *nameserverMatch) match(labels []string) bool {
+	offset := len(labels) - len(m.labels)
+	if offset < 0 {
+		return false
+	}
+	for i, pattern := range m.labels {
+		if ok, _ := path.Match(pattern, labels[offset+i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchNameservers returns the pattern with the most labels matching
+// one of the nameservers
+func (idx *dataIndex) matchNameservers(nameservers []string) (*nameserverMatch, bool) {
+	var best *nameserverMatch
+	for _, nameserver := range nameservers {
+		normalized := normalizeSuffix(nameserver)
+		if normalized == "" {
+			continue
+		}
+		labels := strings.Split(normalized, ".")
+		for _, match := range idx.nameservers {
+			if (best == nil || len(match.labels) > len(best.labels)) && match.match(labels) {
+				best = match
+			}
+		}
+	}
+	return best, best != nil
+}
+
+// setNameservers sets the provider of the longest pattern matching any of
+// the nameservers to the result
+func (idx *dataIndex) setNameservers(result *Result, nameservers []string) {
+	if match, ok := idx.matchNameservers(nameservers); ok {
+		result.Matched = true
+		result.Category = match.categories[0]
+		result.Categories = slices.Clone(match.categories)
+		result.Provider = match.provider
+		result.Suffix = match.pattern
+		result.Method = DetectionMethodNS
+	}
+}
+
+// registrableDomain returns the registrable domain of a domain, e.g.
+// example.co.uk for www.example.co.uk, or the domain itself if it has none
+func registrableDomain(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if registrable, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil {
+		return registrable
+	}
+	return domain
+}
+
+// CheckNS checks if the nameservers the registrable domain of a domain
+// is delegated to belong to a dns provider
+func (c *Client) CheckNS(domain string) (matched bool, value string, itemType string, err error) {
+	return c.CheckNSContext(context.Background(), domain)
+}
+
+// CheckNSContext is same as CheckNS but aborts the dns lookup once ctx
+// is cancelled or its deadline is exceeded
+func (c *Client) CheckNSContext(ctx context.Context, domain string) (matched bool, value string, itemType string, err error) {
+	result, err := c.CheckNSResultContext(ctx, domain)
+	if err != nil {
+		return false, "", "", err
+	}
+	matched, value, itemType = result.tuple()
+	return matched, value, itemType, nil
+}
+
+// CheckNSResult is same as CheckNS but returns the nameservers along with
+// the provider
+func (c *Client) CheckNSResult(domain string) (*Result, error) {
+	return c.CheckNSResultContext(context.Background(), domain)
+}
+
+// CheckNSResultContext is same as CheckNSResult but aborts the dns lookup
+// once ctx is cancelled or its deadline is exceeded
+func (c *Client) CheckNSResultContext(ctx context.Context, domain string) (*Result, error) {
+	data, err := c.query(ctx, registrableDomain(domain), dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	result := c.CheckNameservers(data.NS...)
+	result.Input = domain
+	return result, nil
+}
+
+// CheckNameservers checks if nameservers belong to a dns provider, e.g.
+// the ns records of a domain resolved by the caller
+func (c *Client) CheckNameservers(nameservers ...string) *Result {
+	result := &Result{NS: slices.Clone(nameservers)}
+	if len(nameservers) > 0 {
+		result.Input = nameservers[0]
+	}
+	index := c.index()
+	index.setNameservers(result, nameservers)
+	return index.identify(result)
+}
@@ -0,0 +1,99 @@
+package cdncheck
+
+import (
+	"context"
+	"testing"
+
+	"github.com/projectdiscovery/retryabledns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNS(t *testing.T) {
+	server := newTestDNSServer(t,
+		"example.com. 60 IN NS ns-123.awsdns-45.com.",
+		"example.com. 60 IN NS ns-456.awsdns-12.net.",
+		"example.co.uk. 60 IN NS anna.ns.cloudflare.com.",
+		"example.org. 60 IN NS ns1.example.org.",
+	)
+	client, err := NewClient(WithResolvers(server.addr), WithMaxRetries(1))
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckNSResult("www.example.com")
+	require.Nil(t, err, "could not check nameservers")
+	require.True(t, result.Matched, "could not match nameservers")
+	require.Equal(t, "www.example.com", result.Input, "could not get input")
+	require.Equal(t, "aws", result.Provider, "could not get correct provider")
+	require.Equal(t, "dns", result.Category, "could not get correct category")
+	require.Equal(t, DetectionMethodNS, result.Method, "could not get detection method")
+	require.ElementsMatch(t, []string{"ns-123.awsdns-45.com", "ns-456.awsdns-12.net"}, result.NS, "could not get nameservers")
+
+	matched, provider, itemType, err := client.CheckNS("a.b.example.co.uk")
+	require.Nil(t, err, "could not check nameservers")
+	require.True(t, matched, "could not resolve nameservers of registrable domain")
+	require.Equal(t, "cloudflare", provider, "could not get correct provider")
+	require.Equal(t, "dns", itemType, "could not get correct item type")
+
+	matched, provider, _, err = client.CheckNSContext(context.Background(), "example.com")
+	require.Nil(t, err, "could not check nameservers")
+	require.True(t, matched, "could not match nameservers")
+	require.Equal(t, "aws", provider, "could not get correct provider")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, _, err = client.CheckNSContext(ctx, "example.com")
+	require.ErrorIs(t, err, context.Canceled, "could not get cancelled error")
+
+	result, err = client.CheckNSResult("example.org")
+	require.Nil(t, err, "could not check nameservers")
+	require.False(t, result.Matched, "could match unknown nameservers")
+	require.Equal(t, []string{"ns1.example.org"}, result.NS, "could not get unknown nameservers")
+}
+
+func TestCheckNameservers(t *testing.T) {
+	data := &InputCompiled{
+		Nameservers: map[string][]string{
+			"edge":  {"edgedns-*.net"},
+			"racks": {"ns.racks.example"},
+			"mixed": {"cloud.edgedns-1.net"},
+		},
+		NameserverCategories: map[string][]string{"racks": {"cloud"}},
+	}
+	client, err := NewClient(WithData(data))
+	require.Nil(t, err, "could not create client")
+
+	result := client.CheckNameservers("a.EdgeDNS-12.net.")
+	require.True(t, result.Matched, "could not match wildcard pattern")
+	require.Equal(t, "edge", result.Provider, "could not get correct provider")
+	require.Equal(t, "edgedns-*.net", result.Suffix, "could not get matched pattern")
+
+	result = client.CheckNameservers("a.edgedns-12.net", "ns2.cloud.edgedns-1.net")
+	require.Equal(t, "mixed", result.Provider, "could not prefer longest pattern")
+
+	nameservers := []string{"ns.racks.example"}
+	result = client.CheckNameservers(nameservers...)
+	result.NS[0] = "changed.example"
+	require.Equal(t, "ns.racks.example", nameservers[0], "could alias input nameservers")
+	require.Equal(t, []string{"cloud"}, result.Categories, "could not get declared categories")
+	require.False(t, client.CheckNameservers("edgedns-1.org").Matched, "could match other tld")
+
+	client, err = NewClient(WithData(data), WithCategories("dns"))
+	require.Nil(t, err, "could not create client")
+	require.False(t, client.CheckNameservers("ns.racks.example").Matched, "could match disabled category")
+	require.True(t, client.CheckNameservers("a.edgedns-1.net").Matched, "could not match enabled category")
+}
+
+func TestCheckDNSResponseNameservers(t *testing.T) {
+	client, err := NewClient(WithData(&InputCompiled{Nameservers: map[string][]string{"edge": {"ns.edge.net"}}}))
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckDNSResponseResult(&retryabledns.DNSData{Host: "example.com", NS: []string{"a.ns.edge.net"}})
+	require.Nil(t, err, "could not check dns response")
+	require.True(t, result.Matched, "could not match nameservers of response")
+	require.Equal(t, "edge", result.Provider, "could not get correct provider")
+	require.Equal(t, DetectionMethodNS, result.Method, "could not get detection method")
+	require.Equal(t, []string{"a.ns.edge.net"}, result.NS, "could not get nameservers")
+
+	matched, _, _, err := client.CheckDNSResponse(&retryabledns.DNSData{Host: "example.com", NS: []string{"a.ns.edge.net"}})
+	require.Nil(t, err, "could not check dns response")
+	require.False(t, matched, "could match nameservers with the legacy tuple")
+}
@@ -0,0 +1,332 @@
+package cdncheck
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/retryabledns"
+)
+
+// DefaultMaxRetries is the default number of retries for dns resolution
+const DefaultMaxRetries = 3
+
+// Categories contains the default categories in check order, used when
+// the provider data declares none
+var Categories = []string{"cdn", "waf", "cloud"}
+
+// IPFamily selects the address family of the default resolvers
+type IPFamily int
+
+const (
+	// IPFamilyAuto uses IPv6 resolvers when IPv6 connectivity is available,
+	// falling back to IPv4 ones if they turn out unreachable at query time
+	IPFamilyAuto IPFamily = iota
+	// IPFamilyIPv4 uses IPv4 resolvers only
+	IPFamilyIPv4
+	// IPFamilyIPv6 uses IPv6 resolvers only
+	IPFamilyIPv6
+)
+
+// Option configures a Client created with NewClient
+type Option func(*clientOptions)
+
+// clientOptions contains the configuration of a Client
+type clientOptions struct {
+	resolvers  []string
+	ipFamily   IPFamily
+	maxRetries int
+	maxDepth   int
+	timeout    time.Duration
+	sources    []DataSource
+	categories []string
+	providers  map[string]map[string][]string
+	cache      Cache
+	logger     *gologger.Logger
+	maxDataAge time.Duration
+	mmdbPaths  []string
+	mmdb       []*mmdbDatabase
+	asnRules   []ASNRule
+}
+
+// WithResolvers sets the resolvers used for dns resolution
+func WithResolvers(resolvers ...string) Option {
+	return func(o *clientOptions) {
+		o.resolvers = resolvers
+	}
+}
+
+// WithIPFamily sets the address family of the default resolvers.
+//
+// It has no effect when resolvers are provided using WithResolvers.
+func WithIPFamily(family IPFamily) Option {
+	return func(o *clientOptions) {
+		o.ipFamily = family
+	}
+}
+
+// WithMaxRetries sets the maximum number of retries for dns resolution
+func WithMaxRetries(maxRetries int) Option {
+	return func(o *clientOptions) {
+		o.maxRetries = maxRetries
+	}
+}
+
+// WithMaxCNAMEDepth sets the maximum number of cnames followed for a domain
+func WithMaxCNAMEDepth(depth int) Option {
+	return func(o *clientOptions) {
+		o.maxDepth = depth
+	}
+}
+
+// WithTimeout sets the timeout of a single dns query
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithData sets the compiled provider data used instead of the embedded one.
+//
+// It is a shorthand for WithDataSources with a single static source.
+func WithData(data *InputCompiled) Option {
+	return WithDataSources(NewStaticSource(data))
+}
+
+// WithDataSources sets the sources of the provider data used instead of the
+// embedded one. Sources are layered in order, a provider of a later source
+// replacing the same provider of the earlier ones.
+func WithDataSources(sources ...DataSource) Option {
+	return func(o *clientOptions) {
+		o.sources = append(o.sources, sources...)
+	}
+}
+
+// WithCategories restricts the checks to the specified categories, which
+// must be present in the provider data (e.g. cdn, waf, cloud)
+func WithCategories(categories ...string) Option {
+	return func(o *clientOptions) {
+		o.categories = categories
+	}
+}
+
+// WithProvider adds CIDR ranges of a custom provider to a category.
+//
+// Ranges are merged with the ones of an existing provider having the same name.
+func WithProvider(category, provider string, cidrs ...string) Option {
+	return func(o *clientOptions) {
+		if o.providers == nil {
+			o.providers = make(map[string]map[string][]string)
+		}
+		if o.providers[category] == nil {
+			o.providers[category] = make(map[string][]string)
+		}
+		o.providers[category][provider] = append(o.providers[category][provider], cidrs...)
+	}
+}
+
+// WithMaxDataAge logs a warning when the provider data was generated
+// longer than maxAge ago, checked on creation and on every reload
+func WithMaxDataAge(maxAge time.Duration) Option {
+	return func(o *clientOptions) {
+		o.maxDataAge = maxAge
+	}
+}
+
+// WithMMDB enriches the results with the country and autonomous system of
+// the ips found in databases in the MaxMind DB format, such as GeoLite2 ASN
+// and Country or the ipinfo ones. The databases are read once on creation
+// and queried offline, the first one having a field being used for it.
+func WithMMDB(paths ...string) Option {
+	return func(o *clientOptions) {
+		o.mmdbPaths = append(o.mmdbPaths, paths...)
+	}
+}
+
+// WithASNRules attributes the ips announced by autonomous systems to
+// providers, e.g. all of AS13335 to the cloudflare waf, when the ranges
+// of the data have no provider for them
+func WithASNRules(rules ...ASNRule) Option {
+	return func(o *clientOptions) {
+		o.asnRules = append(o.asnRules, rules...)
+	}
+}
+
+// WithCache sets the cache used to store dns responses between lookups
+func WithCache(cache Cache) Option {
+	return func(o *clientOptions) {
+		o.cache = cache
+	}
+}
+
+// WithLogger sets the logger used for diagnostic messages of the client
+func WithLogger(logger *gologger.Logger) Option {
+	return func(o *clientOptions) {
+		o.logger = logger
+	}
+}
+
+// validate validates and fills the defaults of the options
+func (o *clientOptions) validate() error {
+	if o.maxRetries <= 0 {
+		o.maxRetries = DefaultMaxRetries
+	}
+	if o.maxDepth <= 0 {
+		o.maxDepth = DefaultMaxCNAMEDepth
+	}
+	if o.ipFamily < IPFamilyAuto || o.ipFamily > IPFamilyIPv6 {
+		return fmt.Errorf("invalid ip family %d specified", o.ipFamily)
+	}
+	if len(o.sources) == 0 {
+		o.sources = []DataSource{NewEmbeddedSource()}
+	}
+	for _, rule := range o.asnRules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	if o.logger == nil {
+		o.logger = gologger.DefaultLogger
+	}
+	return nil
+}
+
+// validateCategories validates the categories of the options against
+// the ones of the provider data
+func (o *clientOptions) validateCategories(data *InputCompiled) error {
+	names := data.CategoryNames()
+	for _, category := range o.categories {
+		if !slices.Contains(names, category) {
+			return fmt.Errorf("invalid category %s specified", category)
+		}
+	}
+	for category := range o.providers {
+		if !slices.Contains(names, category) {
+			return fmt.Errorf("invalid category %s specified for provider", category)
+		}
+	}
+	for _, rule := range o.asnRules {
+		if !slices.Contains(names, rule.Category) {
+			return fmt.Errorf("invalid category %s specified for asn rule", rule.Category)
+		}
+	}
+	return nil
+}
+
+// enabled returns true if the checks are not restricted to other categories
+func (o *clientOptions) enabled(category string) bool {
+	return len(o.categories) == 0 || slices.Contains(o.categories, category)
+}
+
+// customProviders returns the providers added using WithProvider
+func (o *clientOptions) customProviders() map[string]map[string]*customProvider {
+	providers := make(map[string]map[string]*customProvider, len(o.providers))
+	for category, items := range o.providers {
+		providers[category] = make(map[string]*customProvider, len(items))
+		for provider, cidrs := range items {
+			providers[category][provider] = &customProvider{cidrs: cidrs}
+		}
+	}
+	return providers
+}
+
+// NewClient creates cdncheck client configured with the provided options
+func NewClient(opts ...Option) (*Client, error) {
+	options := &clientOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	resolvers, fallbackResolvers := options.defaultResolvers()
+	dnsClient, err := newDNSClient(resolvers, options.maxRetries, options.timeout)
+	if err != nil {
+		return nil, err
+	}
+	data, err := loadSources(context.Background(), options.sources)
+	if err != nil {
+		return nil, err
+	}
+	if err := options.validateCategories(data); err != nil {
+		return nil, err
+	}
+	for _, path := range options.mmdbPaths {
+		database, err := openMMDB(path)
+		if err != nil {
+			return nil, err
+		}
+		options.mmdb = append(options.mmdb, database)
+	}
+	client := &Client{
+		loaded:        data,
+		providers:     options.customProviders(),
+		options:       options,
+		dnsClient:     dnsClient,
+		maxCNAMEDepth: options.maxDepth,
+		cache:         options.cache,
+		logger:        options.logger,
+	}
+	if len(fallbackResolvers) > 0 {
+		if client.fallbackdns, err = newDNSClient(fallbackResolvers, options.maxRetries, options.timeout); err != nil {
+			return nil, err
+		}
+	}
+	client.data.Store(options.buildIndex(client.loaded, client.providers))
+	client.checkDataAge()
+	return client, nil
+}
+
+// defaultResolvers returns the resolvers to use along with the IPv4
+// resolvers to fall back to when IPv6 ones fail at query time
+func (o *clientOptions) defaultResolvers() (resolvers []string, fallback []string) {
+	if len(o.resolvers) > 0 {
+		return o.resolvers, nil
+	}
+	switch o.ipFamily {
+	case IPFamilyIPv4:
+		return DefaultResolvers, nil
+	case IPFamilyIPv6:
+		return IPv6Resolvers, nil
+	}
+	if !hasIPv6Connectivity() {
+		return DefaultResolvers, nil
+	}
+	return IPv6Resolvers, DefaultResolvers
+}
+
+// Cache stores dns responses of a client between lookups
+type Cache interface {
+	// Get returns the cached response for a key
+	Get(key string) (*retryabledns.DNSData, bool)
+	// Set stores the response for a key
+	Set(key string, data *retryabledns.DNSData)
+}
+
+// memoryCache is an in-memory LRU Cache
+type memoryCache struct {
+	cache *lru.Cache[string, *retryabledns.DNSData]
+}
+
+// NewMemoryCache returns an in-memory Cache holding up to size responses
+func NewMemoryCache(size int) (Cache, error) {
+	cache, err := lru.New[string, *retryabledns.DNSData](size)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryCache{cache: cache}, nil
+}
+
+// Get returns the cached response for a key
+func (m *memoryCache) Get(key string) (*retryabledns.DNSData, bool) {
+	return m.cache.Get(key)
+}
+
+// Set stores the response for a key
+func (m *memoryCache) Set(key string, data *retryabledns.DNSData) {
+	m.cache.Add(key, data)
+}
@@ -0,0 +1,46 @@
+package cdncheck
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientOptions(t *testing.T) {
+	client, err := NewClient(
+		WithCategories("cdn", "cloud"),
+		WithProvider("cdn", "internal", "10.0.0.0/8"),
+	)
+	require.Nil(t, err, "could not create client")
+
+	found, provider, itemType, err := client.Check(net.ParseIP("10.1.2.3"))
+	require.Nil(t, err, "could not check ip in ranger")
+	require.True(t, found, "could not check custom provider ip")
+	require.Equal(t, "internal", provider, "could not get correct provider")
+	require.Equal(t, "cdn", itemType, "could not get correct item type")
+
+	found, _, _, err = client.Check(net.ParseIP("173.245.48.12"))
+	require.Nil(t, err, "could not check ip in ranger")
+	require.False(t, found, "disabled waf category was checked")
+
+	_, err = NewClient(WithCategories("mail"))
+	require.NotNil(t, err, "could create client with invalid category")
+}
+
+func TestNewClientWithData(t *testing.T) {
+	client, err := NewClient(WithData(&InputCompiled{
+		WAF: map[string][]string{"custom": {"192.0.2.0/24"}},
+	}))
+	require.Nil(t, err, "could not create client")
+
+	found, provider, itemType, err := client.Check(net.ParseIP("192.0.2.10"))
+	require.Nil(t, err, "could not check ip in ranger")
+	require.True(t, found, "could not check custom data ip")
+	require.Equal(t, "custom", provider, "could not get correct provider")
+	require.Equal(t, "waf", itemType, "could not get correct item type")
+
+	found, _, _, err = client.Check(net.ParseIP("173.245.48.12"))
+	require.Nil(t, err, "could not check ip in ranger")
+	require.False(t, found, "embedded data was used along custom data")
+}
@@ -1,14 +1,10 @@
 package cdncheck
 
 import (
+	"slices"
 	"strings"
-
-	"github.com/pkg/errors"
-	"github.com/weppos/publicsuffix-go/publicsuffix"
 )
 
-var suffixToSource map[string]string
-
 // cdnWappalyzerTechnologies contains a map of wappalyzer technologies to cdns
 var cdnWappalyzerTechnologies = map[string]string{
 	"imperva":    "imperva",
@@ -20,42 +16,67 @@ var cdnWappalyzerTechnologies = map[string]string{
 
 // CheckFQDN checks if fqdns are known cloud ones
 func (c *Client) CheckSuffix(fqdns ...string) (isCDN bool, provider string, itemType string, err error) {
-	c.Do(func() {
-		suffixToSource = make(map[string]string)
-		for source, suffixes := range generatedData.Common {
-			for _, suffix := range suffixes {
-				suffixToSource[suffix] = source
-			}
-		}
-	})
+	result, err := c.CheckSuffixResult(fqdns...)
+	if err != nil {
+		return false, "", "", err
+	}
+	isCDN, provider, itemType = result.tuple()
+	return isCDN, provider, itemType, nil
+}
+
+// CheckSuffixResult is same as CheckSuffix but returns the matched suffix along with the provider
+func (c *Client) CheckSuffixResult(fqdns ...string) (*Result, error) {
+	result := &Result{CNAMEs: slices.Clone(fqdns)}
+	if len(fqdns) > 0 {
+		result.Input = fqdns[0]
+	}
+	index := c.index()
 	for _, fqdn := range fqdns {
-		parsed, err := publicsuffix.Parse(fqdn)
-		if err != nil {
-			return false, "", "", errors.Wrap(err, "could not parse fqdn")
-		}
-		if discovered, ok := suffixToSource[parsed.TLD]; ok {
-			return true, discovered, "waf", nil
-		}
-		domain := parsed.SLD + "." + parsed.TLD
-		if discovered, ok := suffixToSource[domain]; ok {
-			return true, discovered, "waf", nil
+		if match, ok := index.suffixes.match(fqdn); ok {
+			result.Input = fqdn
+			result.Matched = true
+			result.Category = match.categories[0]
+			result.Categories = slices.Clone(match.categories)
+			result.Provider = match.provider
+			result.Suffix = match.suffix
+			result.Method = DetectionMethodCNAME
+			return index.identify(result), nil
 		}
 	}
-	return false, "", "", nil
+	return result, nil
 }
 
 // CheckWappalyzer checks if the wappalyzer detection are a part of CDN
 func (c *Client) CheckWappalyzer(data map[string]struct{}) (isCDN bool, provider string, err error) {
+	result, err := c.CheckWappalyzerResult(data)
+	if err != nil {
+		return false, "", err
+	}
+	isCDN, provider, _ = result.tuple()
+	return isCDN, provider, nil
+}
+
+// CheckWappalyzerResult is same as CheckWappalyzer but returns the matched technology along with the provider
+func (c *Client) CheckWappalyzerResult(data map[string]struct{}) (*Result, error) {
+	result := &Result{}
 	for technology := range data {
-		if strings.Contains(technology, ":") {
-			if parts := strings.SplitN(technology, ":", 2); len(parts) == 2 {
-				technology = parts[0]
+		name := technology
+		if strings.Contains(name, ":") {
+			if parts := strings.SplitN(name, ":", 2); len(parts) == 2 {
+				name = parts[0]
 			}
 		}
-		technology = strings.ToLower(technology)
-		if discovered, ok := cdnWappalyzerTechnologies[technology]; ok {
-			return true, discovered, nil
+		name = strings.ToLower(name)
+		if discovered, ok := cdnWappalyzerTechnologies[name]; ok {
+			result.Input = technology
+			result.Matched = true
+			result.Category = "cdn"
+			result.Categories = []string{"cdn"}
+			result.Provider = discovered
+			result.Technology = name
+			result.Method = DetectionMethodWappalyzer
+			return c.index().identify(result), nil
 		}
 	}
-	return false, "", nil
+	return result, nil
 }
@@ -1,7 +1,10 @@
 package cdncheck
 
 import (
+	"context"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/projectdiscovery/retryabledns"
 	stringsutil "github.com/projectdiscovery/utils/strings"
@@ -11,7 +14,8 @@ import (
 )
 
 func TestCheckSuffix(t *testing.T) {
-	client := New()
+	client, err := New()
+	require.Nil(t, err, "could not create client")
 
 	valid, provider, _, err := client.CheckSuffix("test.cloudfront.net")
 	require.Nil(t, err, "could not check cname")
@@ -23,8 +27,54 @@ func TestCheckSuffix(t *testing.T) {
 	require.False(t, valid, "could get valid cname")
 }
 
+func TestCheckSuffixResult(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckSuffixResult("test.provider.net", "d1234.cloudfront.net")
+	require.Nil(t, err, "could not check cname")
+	require.True(t, result.Matched, "could not get valid cname")
+	require.Equal(t, "d1234.cloudfront.net", result.Input, "could not get matched cname")
+	require.Equal(t, "amazon", result.Provider, "could not get correct provider")
+	require.Equal(t, "cloudfront.net", result.Suffix, "could not get matched suffix")
+	require.Equal(t, DetectionMethodCNAME, result.Method, "could not get detection method")
+	require.Equal(t, "cdn", result.Category, "could not get primary category")
+	require.Equal(t, []string{"cdn", "cloud"}, result.Categories, "could not get declared categories")
+
+	fqdns := []string{"d1234.cloudfront.net"}
+	result, err = client.CheckSuffixResult(fqdns...)
+	require.Nil(t, err, "could not check cname")
+	result.CNAMEs[0] = "changed.example"
+	require.Equal(t, "d1234.cloudfront.net", fqdns[0], "could alias input cnames")
+	result.Categories[0] = "changed"
+	result, err = client.CheckSuffixResult(fqdns...)
+	require.Nil(t, err, "could not check cname")
+	require.Equal(t, []string{"cdn", "cloud"}, result.Categories, "could change categories of the data through a result")
+
+	result, err = client.CheckSuffixResult("test.impervadns.net")
+	require.Nil(t, err, "could not check cname")
+	require.Equal(t, "incapsula", result.Provider, "could not get correct provider")
+	require.Equal(t, "waf", result.Category, "could not get correct category")
+}
+
+func TestCheckSuffixCategories(t *testing.T) {
+	client, err := NewClient(WithCategories("cloud"))
+	require.Nil(t, err, "could not create client")
+
+	valid, provider, itemType, err := client.CheckSuffix("d1234.cloudfront.net")
+	require.Nil(t, err, "could not check cname")
+	require.True(t, valid, "could not get valid cname")
+	require.Equal(t, "amazon", provider, "could not get correct provider")
+	require.Equal(t, "cloud", itemType, "could not get enabled category")
+
+	valid, _, _, err = client.CheckSuffix("test.fastly.net")
+	require.Nil(t, err, "could not check cname")
+	require.False(t, valid, "could get cname of disabled category")
+}
+
 func TestCheckWappalyzer(t *testing.T) {
-	client := New()
+	client, err := New()
+	require.Nil(t, err, "could not create client")
 
 	valid, provider, err := client.CheckWappalyzer(map[string]struct{}{"imperva": {}})
 	require.Nil(t, err, "could not check wappalyzer")
@@ -42,7 +92,8 @@ func TestCheckWappalyzer(t *testing.T) {
 }
 
 func TestCheckDomainWithFallback(t *testing.T) {
-	client := New()
+	client, err := New()
+	require.Nil(t, err, "could not create client")
 
 	valid, provider, itemType, err := client.CheckDomainWithFallback("www.gap.com")
 	// skip if ipv6 not enabled
@@ -56,12 +107,36 @@ func TestCheckDomainWithFallback(t *testing.T) {
 	require.Equal(t, "waf", itemType, "could not get correct itemType")
 }
 
+func TestCheckDomainWithFallbackContext(t *testing.T) {
+	// resolver which never answers so lookups can only end through the context
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "could not listen")
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	client, err := NewWithOpts(3, []string{conn.LocalAddr().String()})
+	require.Nil(t, err, "could not create client")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, _, err = client.CheckDomainWithFallbackContext(ctx, "example.com")
+	require.ErrorIs(t, err, context.Canceled, "could not get cancelled error")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.GetDnsDataContext(ctx, "example.com")
+	require.ErrorIs(t, err, context.DeadlineExceeded, "could not get deadline error")
+	require.NotErrorIs(t, err, context.Canceled, "deadline reported as cancellation")
+}
+
 func isIPv6Error(err error) bool {
 	return err != nil && stringsutil.ContainsAnyI(err.Error(), "no route to host", "network is unreachable", "socket operation was attempted to an unreachable network")
 }
 
 func TestCheckDNSResponseIPv6(t *testing.T) {
-	client := New()
+	client, err := New()
+	require.Nil(t, err, "could not create client")
 	defaultResolvers := []string{
 		"[2001:4860:4860::8888]:53",
 		"[2001:4860:4860::8800]:53",
@@ -84,7 +159,8 @@ func TestCheckDNSResponseIPv6(t *testing.T) {
 }
 
 func TestCheckDNSResponseIPv4(t *testing.T) {
-	client := New()
+	client, err := New()
+	require.Nil(t, err, "could not create client")
 	defaultResolvers := []string{
 		"[2001:4860:4860::8888]:53",
 		"[2001:4860:4860::8800]:53",
@@ -0,0 +1,57 @@
+package cdncheck
+
+import (
+	"slices"
+	"strings"
+)
+
+// PathSeparator separates the segments of hierarchical provider names,
+// e.g. aws/ec2/us-east-1 for the us-east-1 region of the ec2 service of aws
+const PathSeparator = "/"
+
+// SplitProviderPath splits a hierarchical provider name into the provider
+// and the path of the service and region below it, which is empty for
+// plain provider names
+func SplitProviderPath(name string) (provider, path string) {
+	provider, path, _ = strings.Cut(name, PathSeparator)
+	return provider, path
+}
+
+// HasPathPrefix returns true if the segments of prefix are the leading
+// segments of path, segments being compared case-insensitively
+func HasPathPrefix(path, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	segments, prefixSegments := strings.Split(path, PathSeparator), strings.Split(prefix, PathSeparator)
+	if len(prefixSegments) > len(segments) {
+		return false
+	}
+	for index, segment := range prefixSegments {
+		if !strings.EqualFold(segments[index], segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// providerRoots returns the sorted providers of hierarchical names
+func providerRoots(names []string) []string {
+	var roots []string
+	for _, name := range names {
+		provider, _ := SplitProviderPath(name)
+		roots = appendUnique(roots, provider)
+	}
+	slices.Sort(roots)
+	return roots
+}
+
+// providerMatch returns the provider of a hierarchical name along with
+// the name itself as path if it has one
+func providerMatch(name string) (provider, path string) {
+	provider, rest := SplitProviderPath(name)
+	if rest == "" {
+		return provider, ""
+	}
+	return provider, name
+}
@@ -0,0 +1,62 @@
+package cdncheck
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderPaths(t *testing.T) {
+	client, err := NewClient(WithDataSources(
+		NewStaticSource(&InputCompiled{
+			Cloud: map[string][]string{
+				"aws":               {"10.0.0.0/8"},
+				"aws/ec2/us-east-1": {"192.0.2.0/24"},
+				"aws/cloudfront":    {"198.51.100.0/24"},
+				"oracle":            {"203.0.113.0/24"},
+			},
+			Registry: []ProviderInfo{{ID: "amazon"}, {ID: "aws", Parent: "amazon"}},
+		}),
+		NewStaticSource(&InputCompiled{
+			Cloud: map[string][]string{"oracle/oci/us-phoenix-1": {"203.0.113.0/25"}},
+		}),
+	))
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckResult(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Equal(t, "aws", result.Provider, "could not get provider of path")
+	require.Equal(t, "aws/ec2/us-east-1", result.Path, "could not get path")
+
+	matched, provider, err := client.CheckCloud(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, matched, "could not match ip of path")
+	require.Equal(t, "aws", provider, "could not get provider of path")
+
+	result, err = client.CheckResult(net.ParseIP("10.0.0.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Empty(t, result.Path, "could get path of plain provider")
+
+	result, err = client.CheckResult(net.ParseIP("203.0.113.200"))
+	require.Nil(t, err, "could not check ip")
+	require.False(t, result.Matched, "could not replace provider with its paths of a later layer")
+
+	matches, err := client.CheckAll(net.ParseIP("203.0.113.1"))
+	require.Nil(t, err, "could not check all")
+	require.Equal(t, []Match{{Category: "cloud", Provider: "oracle", Path: "oracle/oci/us-phoenix-1", Prefix: "203.0.113.0/25"}}, matches, "could not get path of match")
+
+	require.True(t, client.MatchProvider("aws/ec2/us-east-1", "aws/ec2"), "could not match path prefix")
+	require.True(t, client.MatchProvider("aws/ec2/us-east-1", "AWS/EC2/US-EAST-1"), "could not match path case-insensitively")
+	require.True(t, client.MatchProvider("aws/ec2/us-east-1", "amazon/ec2"), "could not match path prefix of parent")
+	require.True(t, client.MatchProvider("aws/ec2/us-east-1", "aws"), "could not match path by provider")
+	require.False(t, client.MatchProvider("aws/ec2/us-east-1", "aws/ec"), "could match partial segment")
+	require.False(t, client.MatchProvider("aws/cloudfront", "aws/ec2"), "could match other service")
+	require.False(t, client.MatchProvider("aws", "aws/ec2"), "could match provider without path")
+
+	require.Nil(t, client.ReplaceProvider(Provider{Category: "cloud", Name: "aws", CIDRs: []string{"10.0.0.0/8"}}), "could not replace provider")
+	matched, _, err = client.CheckCloud(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.False(t, matched, "could not replace paths along with provider")
+	require.Equal(t, "aws, oracle", mapKeys(map[string][]string{"aws/ec2": nil, "aws": nil, "oracle/oci": nil}), "could not get providers of paths")
+}
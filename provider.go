@@ -0,0 +1,116 @@
+package cdncheck
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// Provider is a custom provider registered on a client at runtime
+type Provider struct {
+	// Category is the category of the provider, one of the data (e.g. cdn, waf, cloud)
+	Category string
+	// Name is the name reported for the provider
+	Name string
+	// CIDRs contains the ranges of the provider
+	CIDRs []string
+	// Suffixes contains the cname suffixes of the provider
+	Suffixes []string
+}
+
+// customProvider contains the changes made to a provider of a category
+type customProvider struct {
+	// replace drops the ranges and suffixes the data has for the provider
+	replace  bool
+	cidrs    []string
+	suffixes []string
+}
+
+// validate validates the provider
+func (p *Provider) validate() error {
+	if err := validateProvider(p.Category, p.Name); err != nil {
+		return err
+	}
+	for _, cidr := range p.CIDRs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			return fmt.Errorf("invalid cidr %s specified for provider %s: %s", cidr, p.Name, err)
+		}
+	}
+	for _, suffix := range p.Suffixes {
+		if normalizeSuffix(suffix) == "" {
+			return fmt.Errorf("invalid suffix %q specified for provider %s", suffix, p.Name)
+		}
+	}
+	return nil
+}
+
+// validateProvider validates the category and name of a provider
+func validateProvider(category, name string) error {
+	if category == "" {
+		return fmt.Errorf("no category specified for provider %s", name)
+	}
+	if name == "" {
+		return fmt.Errorf("no name specified for provider")
+	}
+	return nil
+}
+
+// AddProvider adds the ranges and suffixes of a provider to a category,
+// merging them with the ones of an existing provider having the same name.
+//
+// The index of the client is rebuilt and swapped once updated, so it is
+// safe to call while other goroutines are checking.
+func (c *Client) AddProvider(provider Provider) error {
+	if err := provider.validate(); err != nil {
+		return err
+	}
+	return c.updateProvider(provider.Category, provider.Name, func(custom *customProvider) {
+		custom.cidrs = append(custom.cidrs, provider.CIDRs...)
+		custom.suffixes = append(custom.suffixes, provider.Suffixes...)
+	})
+}
+
+// ReplaceProvider replaces the ranges and suffixes of a provider of
+// a category, including the ones coming from the provider data
+func (c *Client) ReplaceProvider(provider Provider) error {
+	if err := provider.validate(); err != nil {
+		return err
+	}
+	return c.updateProvider(provider.Category, provider.Name, func(custom *customProvider) {
+		custom.replace = true
+		custom.cidrs = slices.Clone(provider.CIDRs)
+		custom.suffixes = slices.Clone(provider.Suffixes)
+	})
+}
+
+// RemoveProvider removes a provider from a category, including the
+// ranges and suffixes coming from the provider data
+func (c *Client) RemoveProvider(category, name string) error {
+	if err := validateProvider(category, name); err != nil {
+		return err
+	}
+	return c.updateProvider(category, name, func(custom *customProvider) {
+		*custom = customProvider{replace: true}
+	})
+}
+
+// updateProvider applies a change to a provider and swaps the index
+func (c *Client) updateProvider(category, name string, update func(custom *customProvider)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !slices.Contains(c.loaded.CategoryNames(), category) {
+		return fmt.Errorf("invalid category %s specified for provider", category)
+	}
+	if c.providers[category] == nil {
+		c.providers[category] = make(map[string]*customProvider)
+	}
+	custom, ok := c.providers[category][name]
+	if !ok {
+		custom = &customProvider{}
+		c.providers[category][name] = custom
+	}
+	update(custom)
+	c.data.Store(c.options.buildIndex(c.loaded, c.providers))
+	return nil
+}
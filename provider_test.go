@@ -0,0 +1,95 @@
+package cdncheck
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientProviders(t *testing.T) {
+	client, err := NewClient(WithData(&InputCompiled{
+		CDN:              map[string][]string{"akamai": {"192.0.2.0/24"}},
+		WAF:              map[string][]string{"akamai": {"198.51.100.0/24"}},
+		Common:           map[string][]string{"akamai": {"edgekey.net"}},
+		CommonCategories: map[string][]string{"akamai": {"waf", "cdn"}},
+	}))
+	require.Nil(t, err, "could not create client")
+
+	err = client.AddProvider(Provider{Category: "cdn", Name: "internal-edge", CIDRs: []string{"10.10.0.0/16"}, Suffixes: []string{"edge.internal.example"}})
+	require.Nil(t, err, "could not add provider")
+	found, provider, itemType, err := client.Check(net.ParseIP("10.10.1.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, found, "could not check ip of added provider")
+	require.Equal(t, "internal-edge", provider, "could not get added provider")
+	require.Equal(t, "cdn", itemType, "could not get category of added provider")
+
+	result, err := client.CheckSuffixResult("app.edge.internal.example")
+	require.Nil(t, err, "could not check cname")
+	require.Equal(t, "internal-edge", result.Provider, "could not get provider of added suffix")
+	require.Equal(t, []string{"cdn"}, result.Categories, "could not get category of added suffix")
+
+	err = client.AddProvider(Provider{Category: "cdn", Name: "internal-edge", CIDRs: []string{"10.20.0.0/16"}})
+	require.Nil(t, err, "could not add provider ranges")
+	matches, err := client.CheckAll(net.ParseIP("10.10.1.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Len(t, matches, 1, "could not keep merged ranges")
+
+	err = client.ReplaceProvider(Provider{Category: "cdn", Name: "akamai", CIDRs: []string{"203.0.113.0/24"}})
+	require.Nil(t, err, "could not replace provider")
+	found, _, err = client.CheckCDN(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.False(t, found, "could get replaced ranges")
+	found, _, err = client.CheckCDN(net.ParseIP("203.0.113.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, found, "could not get replacing ranges")
+	result, err = client.CheckSuffixResult("a.edgekey.net")
+	require.Nil(t, err, "could not check cname")
+	require.Equal(t, []string{"waf"}, result.Categories, "could not drop replaced suffix category")
+
+	require.Nil(t, client.RemoveProvider("waf", "akamai"), "could not remove provider")
+	found, _, err = client.CheckWAF(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check ip")
+	require.False(t, found, "could get removed ranges")
+	result, err = client.CheckSuffixResult("a.edgekey.net")
+	require.Nil(t, err, "could not check cname")
+	require.False(t, result.Matched, "could get removed suffix")
+
+	require.NotNil(t, client.AddProvider(Provider{Category: "mail", Name: "test"}), "could add invalid category")
+	require.NotNil(t, client.AddProvider(Provider{Category: "cdn", Name: "test", CIDRs: []string{"10.0.0.0"}}), "could add invalid cidr")
+	require.NotNil(t, client.RemoveProvider("cdn", ""), "could remove unnamed provider")
+}
+
+func TestClientProvidersConcurrent(t *testing.T) {
+	client, err := NewClient(WithData(&InputCompiled{CDN: map[string][]string{"base": {"192.0.2.0/24"}}}))
+	require.Nil(t, err, "could not create client")
+
+	var wg sync.WaitGroup
+	var missed atomic.Bool
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if found, _, _, err := client.Check(net.ParseIP("192.0.2.1")); err != nil || !found {
+					missed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		require.Nil(t, client.AddProvider(Provider{Category: "waf", Name: "custom", CIDRs: []string{"10.0.0.0/8"}}), "could not add provider")
+		require.Nil(t, client.RemoveProvider("waf", "custom"), "could not remove provider")
+	}
+	close(stop)
+	wg.Wait()
+	require.False(t, missed.Load(), "could not check ip while providers changed")
+}
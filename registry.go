@@ -0,0 +1,200 @@
+package cdncheck
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ProviderInfo describes a provider of the registry
+type ProviderInfo struct {
+	// ID is the stable ascii identifier of the provider
+	ID string `yaml:"id,omitempty" json:"id"`
+	// Name is the display name of the provider
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Names contains the localized display names by language code
+	Names map[string]string `yaml:"names,omitempty" json:"names,omitempty"`
+	// Aliases contains the other names of the provider, including
+	// the names it is reported as in the data
+	Aliases []string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	// Parent is the id of the provider owning this one
+	Parent string `yaml:"parent,omitempty" json:"parent,omitempty"`
+	// Homepage is the url of the homepage of the provider
+	Homepage string `yaml:"homepage,omitempty" json:"homepage,omitempty"`
+	// Abuse is the email address or url abuse is reported to
+	Abuse string `yaml:"abuse,omitempty" json:"abuse,omitempty"`
+	// Categories contains the categories the provider is detected as
+	Categories []string `yaml:"categories,omitempty" json:"categories,omitempty"`
+	// Tags contains the services offered by the provider, which may be
+	// categories it has no ranges for (e.g. dns, ddos-protection)
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// DisplayName returns the name of the provider in a language, falling
+// back to its display name and then to its id
+func (p *ProviderInfo) DisplayName(language string) string {
+	if name, ok := p.Names[language]; ok && name != "" {
+		return name
+	}
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.ID
+}
+
+// clone returns a deep copy of the provider
+func (p *ProviderInfo) clone() ProviderInfo {
+	info := *p
+	info.Names = maps.Clone(p.Names)
+	info.Aliases = slices.Clone(p.Aliases)
+	info.Categories = slices.Clone(p.Categories)
+	info.Tags = slices.Clone(p.Tags)
+	return info
+}
+
+// providerRegistry indexes the providers by their ids and aliases
+type providerRegistry struct {
+	providers map[string]*ProviderInfo
+	names     map[string]*ProviderInfo
+}
+
+// newProviderRegistry returns the registry of the providers. Ids take
+// precedence over aliases, and a later alias over an earlier one.
+func newProviderRegistry(providers []ProviderInfo) *providerRegistry {
+	registry := &providerRegistry{
+		providers: make(map[string]*ProviderInfo, len(providers)),
+		names:     make(map[string]*ProviderInfo, len(providers)),
+	}
+	for index := range providers {
+		provider := &providers[index]
+		registry.providers[provider.ID] = provider
+	}
+	for index := range providers {
+		for _, alias := range providers[index].Aliases {
+			registry.names[normalizeProviderName(alias)] = &providers[index]
+		}
+	}
+	for id, provider := range registry.providers {
+		registry.names[normalizeProviderName(id)] = provider
+	}
+	return registry
+}
+
+// lookup returns the provider having the name as id or alias
+func (r *providerRegistry) lookup(name string) (*ProviderInfo, bool) {
+	provider, ok := r.names[normalizeProviderName(name)]
+	return provider, ok
+}
+
+// id returns the id of the provider having the name, or the
+// normalized name if it is not in the registry
+func (r *providerRegistry) id(name string) string {
+	if provider, ok := r.lookup(name); ok {
+		return provider.ID
+	}
+	return normalizeProviderName(name)
+}
+
+// normalizeProviderName returns the form names are compared in
+func normalizeProviderName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// CategoryProviderIDs returns the sorted registry ids of the providers
+// having ranges in a category of the data
+func (i *InputCompiled) CategoryProviderIDs(category string) []string {
+	registry := newProviderRegistry(i.Registry)
+	var ids []string
+	for name := range i.CategoryRanges(category) {
+		root, _ := SplitProviderPath(name)
+		ids = appendUnique(ids, registry.id(root))
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// mergeRegistry layers the registries of data sources, a provider of
+// a later layer replacing the one with the same id, sorted by id
+func mergeRegistry(layers ...*InputCompiled) []ProviderInfo {
+	providers := make(map[string]ProviderInfo)
+	for _, layer := range layers {
+		for _, provider := range layer.Registry {
+			providers[provider.ID] = provider
+		}
+	}
+	registry := make([]ProviderInfo, 0, len(providers))
+	for _, id := range slices.Sorted(maps.Keys(providers)) {
+		registry = append(registry, providers[id])
+	}
+	return registry
+}
+
+// Provider returns the provider of the registry having the name as id
+// or alias, names being compared case-insensitively
+func (c *Client) Provider(name string) (ProviderInfo, bool) {
+	provider, ok := c.index().registry.lookup(name)
+	if !ok {
+		return ProviderInfo{}, false
+	}
+	return provider.clone(), true
+}
+
+// Providers returns the providers of the registry sorted by id
+func (c *Client) Providers() []ProviderInfo {
+	registry := c.index().registry
+	providers := make([]ProviderInfo, 0, len(registry.providers))
+	for _, id := range slices.Sorted(maps.Keys(registry.providers)) {
+		providers = append(providers, registry.providers[id].clone())
+	}
+	return providers
+}
+
+// ProvidersWithTag returns the providers of the registry having the
+// tag sorted by id, tags being compared case-insensitively
+func (c *Client) ProvidersWithTag(tag string) []ProviderInfo {
+	var providers []ProviderInfo
+	for _, provider := range c.Providers() {
+		if slices.ContainsFunc(provider.Tags, func(value string) bool { return strings.EqualFold(value, tag) }) {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// ProviderID returns the id of the provider having the name as id or
+// alias, or the lowercased name if the provider is not in the registry
+func (c *Client) ProviderID(name string) string {
+	return c.index().registry.id(name)
+}
+
+// MatchProvider returns true if the provider reported as name is one of
+// the filters, given as ids or aliases, or is owned by one of them.
+//
+// Both may be hierarchical names, a filter such as aws/ec2 matching the
+// names whose path starts with the services and regions following the
+// provider, e.g. aws/ec2/us-east-1 but neither aws/s3 nor plain aws.
+func (c *Client) MatchProvider(name string, filters ...string) bool {
+	registry := c.index().registry
+	provider, path := SplitProviderPath(name)
+	ids := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		filter, prefix := SplitProviderPath(filter)
+		if prefix != "" && (path == "" || !HasPathPrefix(path, prefix)) {
+			continue
+		}
+		ids = append(ids, registry.id(filter))
+	}
+	id := registry.id(provider)
+	// parents are followed a bounded number of times in case of cycles
+	for range len(registry.providers) + 1 {
+		if slices.Contains(ids, id) {
+			return true
+		}
+		provider, ok := registry.providers[id]
+		if !ok || provider.Parent == "" {
+			return false
+		}
+		id = provider.Parent
+	}
+	return false
+}
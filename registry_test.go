@@ -0,0 +1,105 @@
+package cdncheck
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientProviderRegistry(t *testing.T) {
+	client, err := NewClient(WithDataSources(
+		NewStaticSource(&InputCompiled{
+			CDN: map[string][]string{"edge-cdn": {"192.0.2.0/24"}},
+			Registry: []ProviderInfo{
+				{ID: "edge", Name: "Edge Group"},
+				{ID: "edge-cdn", Name: "Edge CDN", Names: map[string]string{"zh": "边缘"}, Aliases: []string{"边缘 CDN", "edge"}, Parent: "edge"},
+			},
+		}),
+		NewStaticSource(&InputCompiled{
+			Registry: []ProviderInfo{{ID: "other", Aliases: []string{"Edge Legacy"}, Parent: "edge-cdn"}},
+		}),
+	))
+	require.Nil(t, err, "could not create client")
+
+	provider, ok := client.Provider("边缘 CDN")
+	require.True(t, ok, "could not get provider by alias")
+	require.Equal(t, "edge-cdn", provider.ID, "could not get provider id")
+	require.Equal(t, "边缘", provider.DisplayName("zh"), "could not get localized name")
+	require.Equal(t, "Edge CDN", provider.DisplayName("fr"), "could not fall back to display name")
+
+	provider, ok = client.Provider("EDGE")
+	require.True(t, ok, "could not get provider by id")
+	require.Equal(t, "edge", provider.ID, "could not prefer id over alias")
+
+	provider.Aliases = append(provider.Aliases, "changed")
+	_, ok = client.Provider("changed")
+	require.False(t, ok, "could change registry through returned provider")
+
+	require.Equal(t, "other", client.ProviderID("edge legacy"), "could not get id of alias")
+	require.Equal(t, "unknown", client.ProviderID(" Unknown "), "could not normalize unknown provider")
+	require.Len(t, client.Providers(), 3, "could not merge registries")
+
+	matched, name, err := client.CheckCDN(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.True(t, matched, "could not match ip")
+	require.True(t, client.MatchProvider(name, "边缘 CDN"), "could not match provider by alias")
+	require.True(t, client.MatchProvider(name, "fastly", "edge"), "could not match provider by parent")
+	require.True(t, client.MatchProvider("edge legacy", "edge"), "could not match provider by grandparent")
+	require.False(t, client.MatchProvider(name, "other"), "could match provider by child")
+	require.True(t, client.MatchProvider("unknown", "Unknown"), "could not match unknown provider by name")
+}
+
+func TestResultProviderID(t *testing.T) {
+	client, err := NewClient(WithData(&InputCompiled{
+		CDN:      map[string][]string{"边缘 CDN": {"192.0.2.0/24"}},
+		Common:   map[string][]string{"Edge": {"edge.example"}},
+		Registry: []ProviderInfo{{ID: "edge-cdn", Aliases: []string{"边缘 CDN", "edge"}}},
+	}))
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckResult(net.ParseIP("192.0.2.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Equal(t, "边缘 CDN", result.Provider, "could not get provider name")
+	require.Equal(t, "edge-cdn", result.ProviderID, "could not get provider id of ip")
+
+	result, err = client.CheckSuffixResult("www.edge.example")
+	require.Nil(t, err, "could not check suffix")
+	require.Equal(t, "edge-cdn", result.ProviderID, "could not get provider id of suffix")
+
+	result, err = client.CheckResult(net.ParseIP("198.51.100.1"))
+	require.Nil(t, err, "could not check ip")
+	require.Empty(t, result.ProviderID, "could get provider id of unmatched ip")
+}
+
+func TestEmbeddedProviderRegistry(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	for _, name := range []string{"腾讯云", "腾讯云 CDN", "tencent-cloud"} {
+		require.Equal(t, "tencent-cloud", client.ProviderID(name), "could not resolve %s", name)
+	}
+	require.True(t, client.MatchProvider("cloudfront", "amazon"), "could not match cloudfront as amazon")
+	require.True(t, client.MatchProvider("aws", "amazon"), "could not match aws as amazon")
+
+	provider, ok := client.Provider("cloudflare")
+	require.True(t, ok, "could not get cloudflare")
+	require.Equal(t, []string{"cdn", "waf", "dns"}, provider.Categories, "could not get cloudflare categories")
+}
+
+func TestCategoryProviderIDs(t *testing.T) {
+	data := &InputCompiled{
+		CDN: map[string][]string{
+			"baidu":          {"192.0.2.0/24"},
+			"aws/cloudfront": {"198.51.100.0/24"},
+			"aws/s3":         {"203.0.113.0/24"},
+			"unlisted":       {"198.18.0.0/15"},
+		},
+		Registry: []ProviderInfo{
+			{ID: "baidu-yunjiasu", Aliases: []string{"baidu"}},
+			{ID: "aws", Aliases: []string{"amazon"}},
+		},
+	}
+	require.Equal(t, []string{"aws", "baidu-yunjiasu", "unlisted"}, data.CategoryProviderIDs("cdn"), "could not get provider ids")
+	require.Empty(t, data.CategoryProviderIDs("waf"), "could get ids of empty category")
+}
@@ -0,0 +1,139 @@
+package cdncheck
+
+// DetectionMethod is the source a provider was detected from
+type DetectionMethod string
+
+const (
+	// DetectionMethodIP is used when an ip is contained in provider ranges
+	DetectionMethodIP DetectionMethod = "ip"
+	// DetectionMethodCNAME is used when a cname matches a provider suffix
+	DetectionMethodCNAME DetectionMethod = "cname"
+	// DetectionMethodWappalyzer is used when a wappalyzer technology maps to a provider
+	DetectionMethodWappalyzer DetectionMethod = "wappalyzer"
+	// DetectionMethodASN is used when the autonomous system of an ip maps to a provider
+	DetectionMethodASN DetectionMethod = "asn"
+	// DetectionMethodHTTP is used when an http response matches a provider fingerprint
+	DetectionMethodHTTP DetectionMethod = "http"
+	// DetectionMethodBlock is used when a blocked probe request matches a waf block page
+	DetectionMethodBlock DetectionMethod = "block"
+	// DetectionMethodTLS is used when a tls certificate matches a provider suffix or issuer
+	DetectionMethodTLS DetectionMethod = "tls"
+	// DetectionMethodNS is used when a nameserver of a domain matches a dns provider
+	DetectionMethodNS DetectionMethod = "ns"
+)
+
+// Result contains the outcome of a check along with the evidence for it
+type Result struct {
+	// Input is the ip, domain or fqdn that was checked
+	Input string `json:"input"`
+	// Matched is true if a provider was detected
+	Matched bool `json:"matched"`
+	// Category is the category of the provider (cdn, waf, cloud)
+	Category string `json:"category,omitempty"`
+	// Categories contains all the categories the provider is reported as,
+	// the first one being Category
+	Categories []string `json:"categories,omitempty"`
+	// Provider is the name of the detected provider
+	Provider string `json:"provider,omitempty"`
+	// ProviderID is the id of the detected provider in the registry, or
+	// its lowercased name if the registry does not have it
+	ProviderID string `json:"provider_id,omitempty"`
+	// Path is the hierarchical name of the service and region of the
+	// provider for ip based detections, e.g. aws/ec2/us-east-1, if known
+	Path string `json:"path,omitempty"`
+	// Prefix is the CIDR which matched for ip based detections
+	Prefix string `json:"prefix,omitempty"`
+	// Suffix is the suffix which matched for cname based detections
+	Suffix string `json:"suffix,omitempty"`
+	// Technology is the technology which matched for wappalyzer based detections
+	Technology string `json:"technology,omitempty"`
+	// Fingerprint is the fingerprint which matched for http based
+	// detections, or the certificate name or issuer for tls based ones,
+	// e.g. san:*.akamaized.net
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// TLS contains the handshake of tls based detections
+	TLS *TLSInfo `json:"tls,omitempty"`
+	// NS contains the nameservers of the input for ns based detections and
+	// dns responses having ns records
+	NS []string `json:"ns,omitempty"`
+	// Method is the source the provider was detected from
+	Method DetectionMethod `json:"method,omitempty"`
+	// ASN is the number of the autonomous system announcing the matched
+	// ip, or the first ip having one, if the data has an ip to asn table
+	// or the client has mmdb databases
+	ASN uint32 `json:"asn,omitempty"`
+	// ASNOrg is the organization operating the autonomous system
+	ASNOrg string `json:"asn_org,omitempty"`
+	// Country is the iso code of the country of the ip the autonomous
+	// system was found for, if the client has mmdb databases with countries
+	Country string `json:"country,omitempty"`
+	// IPs contains the ips which were checked, AAAA records first
+	IPs []string `json:"ips,omitempty"`
+	// CNAMEs contains the cname chain of the input
+	CNAMEs []string `json:"cnames,omitempty"`
+	// Chain contains the input and its cname chain with the provider attributed to each hop
+	Chain []Hop `json:"chain,omitempty"`
+}
+
+// Hop is a name of a cname chain along with the provider attributed to it.
+// A hop whose name and ips both match is attributed to the provider of its
+// ips, the evidence of both sources being kept.
+type Hop struct {
+	// Name is the name of the hop
+	Name string `json:"name"`
+	// Matched is true if a provider was attributed to the hop
+	Matched bool `json:"matched"`
+	// Category is the category of the provider of the hop
+	Category string `json:"category,omitempty"`
+	// Categories contains all the categories the provider of the hop is reported as
+	Categories []string `json:"categories,omitempty"`
+	// Provider is the name of the provider of the hop
+	Provider string `json:"provider,omitempty"`
+	// Path is the hierarchical name of the service and region of the
+	// provider if the hop was classified by its ips
+	Path string `json:"path,omitempty"`
+	// Prefix is the CIDR which matched the ips of the hop
+	Prefix string `json:"prefix,omitempty"`
+	// Suffix is the suffix which matched the name of the hop
+	Suffix string `json:"suffix,omitempty"`
+	// Method is the source the provider of the hop was detected from
+	Method DetectionMethod `json:"method,omitempty"`
+	// IPs contains the ips the last hop of the chain resolves to
+	IPs []string `json:"ips,omitempty"`
+	// Evidence contains the provider attributed to the hop by each source,
+	// its name first and its ips next
+	Evidence []Evidence `json:"evidence,omitempty"`
+}
+
+// Evidence is a provider attributed to a hop by one source
+type Evidence struct {
+	// Category is the category of the provider
+	Category string `json:"category"`
+	// Provider is the name of the provider
+	Provider string `json:"provider"`
+	// Path is the hierarchical name of the service and region of the provider
+	Path string `json:"path,omitempty"`
+	// Prefix is the CIDR which matched for ip based evidence
+	Prefix string `json:"prefix,omitempty"`
+	// Suffix is the suffix which matched for cname based evidence
+	Suffix string `json:"suffix,omitempty"`
+	// Method is the source of the evidence
+	Method DetectionMethod `json:"method"`
+}
+
+// identify sets the id of the detected provider in the registry of the
+// index to the result
+func (idx *dataIndex) identify(result *Result) *Result {
+	if result.Matched && result.Provider != "" {
+		result.ProviderID = idx.registry.id(result.Provider)
+	}
+	return result
+}
+
+// tuple returns the legacy tuple form of the result
+func (r *Result) tuple() (matched bool, value string, itemType string) {
+	if r == nil || !r.Matched {
+		return false, "", ""
+	}
+	return true, r.Provider, r.Category
+}
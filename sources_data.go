@@ -1,21 +1,47 @@
+//go:build !cdncheck_json
+
 package cdncheck
 
 import (
 	_ "embed"
-	"encoding/json"
-	"fmt"
-)
+	"strings"
 
-//go:embed sources_data.json
-var data string
+	"github.com/pkg/errors"
+)
 
-var generatedData InputCompiled
+// sources_data.bin is the binary index of sources_data.json generated
+// along with it, the json file is embedded instead with the cdncheck_json tag.
+// There is no fallback between the two at runtime, a corrupt index failing
+// to load with an error.
+//
+//go:embed sources_data.bin
+var embeddedIndex []byte
 
 func init() {
-	if err := json.Unmarshal([]byte(data), &generatedData); err != nil {
-		panic(fmt.Sprintf("Could not parse cidr data: %s", err))
+	// only the provider names of the header are read here, the ranges
+	// are decoded once the embedded data is first used
+	_, categories, err := decodeBinaryHeader(embeddedIndex)
+	if err != nil {
+		return
+	}
+	for _, category := range categories {
+		providers := strings.Join(providerRoots(category.providers), ", ")
+		switch category.name {
+		case "cdn":
+			DefaultCDNProviders = providers
+		case "waf":
+			DefaultWafProviders = providers
+		case "cloud":
+			DefaultCloudProviders = providers
+		}
+	}
+}
+
+// loadEmbeddedData decodes the embedded binary index
+func loadEmbeddedData() (*InputCompiled, error) {
+	data := &InputCompiled{}
+	if err := data.UnmarshalBinary(embeddedIndex); err != nil {
+		return nil, errors.Wrap(err, "could not decode embedded data")
 	}
-	DefaultCDNProviders = mapKeys(generatedData.CDN)
-	DefaultWafProviders = mapKeys(generatedData.WAF)
-	DefaultCloudProviders = mapKeys(generatedData.Cloud)
+	return data, nil
 }
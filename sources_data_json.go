@@ -0,0 +1,38 @@
+//go:build cdncheck_json
+
+package cdncheck
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed sources_data.json
+var embeddedJSON []byte
+
+func init() {
+	// only the provider names are read here, the ranges are left raw and
+	// parsed once the embedded data is first used
+	var names struct {
+		CDN   map[string]json.RawMessage `json:"cdn"`
+		WAF   map[string]json.RawMessage `json:"waf"`
+		Cloud map[string]json.RawMessage `json:"cloud"`
+	}
+	if err := json.Unmarshal(embeddedJSON, &names); err != nil {
+		return
+	}
+	DefaultCDNProviders = mapKeys(names.CDN)
+	DefaultWafProviders = mapKeys(names.WAF)
+	DefaultCloudProviders = mapKeys(names.Cloud)
+}
+
+// loadEmbeddedData parses the embedded json data
+func loadEmbeddedData() (*InputCompiled, error) {
+	data := &InputCompiled{}
+	if err := json.Unmarshal(embeddedJSON, data); err != nil {
+		return nil, errors.Wrap(err, "could not parse embedded data")
+	}
+	return data, nil
+}
@@ -0,0 +1,104 @@
+package cdncheck
+
+import (
+	"strings"
+)
+
+// wildcardLabel is a suffix label matching any single label
+const wildcardLabel = "*"
+
+// suffixTrie is a trie of provider suffixes keyed by their labels from
+// right to left, so matching an fqdn is a single walk down its labels.
+type suffixTrie struct {
+	root *suffixNode
+}
+
+// suffixNode is a label of the trie
+type suffixNode struct {
+	children map[string]*suffixNode
+	// source is set if a suffix ends at the node
+	source *suffixMatch
+}
+
+// suffixMatch is a suffix matching an fqdn along with its source
+type suffixMatch struct {
+	provider   string
+	suffix     string
+	categories []string
+}
+
+// newSuffixTrie returns a trie of the suffixes, a suffix declared
+// several times belonging to its first source
+func newSuffixTrie(matches []*suffixMatch) *suffixTrie {
+	trie := &suffixTrie{root: &suffixNode{}}
+	for _, match := range matches {
+		trie.insert(match)
+	}
+	return trie
+}
+
+// insert adds a suffix to the trie keeping the first source of a suffix
+func (t *suffixTrie) insert(match *suffixMatch) {
+	suffix := normalizeSuffix(match.suffix)
+	if suffix == "" {
+		return
+	}
+	match.suffix = suffix
+	node := t.root
+	labels := strings.Split(suffix, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		child, ok := node.children[labels[i]]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*suffixNode)
+			}
+			child = &suffixNode{}
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+	if node.source == nil {
+		node.source = match
+	}
+}
+
+// match returns the longest suffix matching the fqdn.
+//
+// An exact label is preferred over a wildcard one when both lead
+// to suffixes of the same length.
+func (t *suffixTrie) match(fqdn string) (suffixMatch, bool) {
+	fqdn = normalizeSuffix(fqdn)
+	if fqdn == "" {
+		return suffixMatch{}, false
+	}
+	labels := strings.Split(fqdn, ".")
+	match, _ := t.root.match(labels, len(labels)-1, 0)
+	if match == nil {
+		return suffixMatch{}, false
+	}
+	return *match, true
+}
+
+// match walks the labels from index i down, returning the deepest source
+// found below the node along with its depth
+func (n *suffixNode) match(labels []string, i, depth int) (*suffixMatch, int) {
+	best, bestDepth := n.source, depth
+	if i < 0 {
+		return best, bestDepth
+	}
+	for _, label := range []string{labels[i], wildcardLabel} {
+		child, ok := n.children[label]
+		if !ok {
+			continue
+		}
+		if match, matchDepth := child.match(labels, i-1, depth+1); match != nil && matchDepth > bestDepth {
+			best, bestDepth = match, matchDepth
+		}
+	}
+	return best, bestDepth
+}
+
+// normalizeSuffix lowercases a suffix or fqdn trimming its leading and trailing dots
+func normalizeSuffix(value string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(value)), ".")
+}
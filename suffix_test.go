@@ -0,0 +1,60 @@
+package cdncheck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuffixTrieMatch(t *testing.T) {
+	var matches []*suffixMatch
+	for _, item := range [][2]string{
+		{"duplicate", "shared.net"},
+		{"duplicated", "shared.net"},
+		{"exact", "edge.eu.example.net"},
+		{"fastly", "fastly.net"},
+		{"fastly", "global.ssl.fastly.net"},
+		{"incapsula", "x.incapdns.net"},
+		{"trailing", ".trailing.net."},
+		{"wildcard", "edge.*.example.net"},
+	} {
+		matches = append(matches, &suffixMatch{provider: item[0], suffix: item[1], categories: []string{"cdn"}})
+	}
+	trie := newSuffixTrie(matches)
+
+	tests := []struct {
+		fqdn     string
+		provider string
+		suffix   string
+	}{
+		{fqdn: "a.global.ssl.fastly.net", provider: "fastly", suffix: "global.ssl.fastly.net"},
+		{fqdn: "a.fastly.net", provider: "fastly", suffix: "fastly.net"},
+		{fqdn: "site.x.incapdns.net.", provider: "incapsula", suffix: "x.incapdns.net"},
+		{fqdn: "a.edge.us.example.net", provider: "wildcard", suffix: "edge.*.example.net"},
+		{fqdn: "a.edge.eu.example.net", provider: "exact", suffix: "edge.eu.example.net"},
+		{fqdn: "A.Trailing.NET", provider: "trailing", suffix: "trailing.net"},
+		{fqdn: "a.shared.net", provider: "duplicate", suffix: "shared.net"},
+	}
+	for _, test := range tests {
+		match, ok := trie.match(test.fqdn)
+		require.True(t, ok, "could not match %s", test.fqdn)
+		require.Equal(t, test.provider, match.provider, "could not get correct provider for %s", test.fqdn)
+		require.Equal(t, test.suffix, match.suffix, "could not get longest suffix for %s", test.fqdn)
+	}
+
+	for _, fqdn := range []string{"x.incapdns.net.evil.com", "incapdns.net", "edge.example.net", "", "."} {
+		_, ok := trie.match(fqdn)
+		require.False(t, ok, "could match %q", fqdn)
+	}
+}
+
+func TestCheckSuffixMultiLabel(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	result, err := client.CheckSuffixResult("example.com.cdn.cloudflare.net.")
+	require.Nil(t, err, "could not check cname")
+	require.True(t, result.Matched, "could not get valid cname")
+	require.Equal(t, "cloudflare", result.Provider, "could not get correct provider")
+	require.Equal(t, "cdn.cloudflare.net", result.Suffix, "could not get matched suffix")
+}
@@ -0,0 +1,172 @@
+package cdncheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// TLSInfo contains the negotiated parameters and the certificate of a tls
+// handshake
+type TLSInfo struct {
+	// Version is the negotiated version, e.g. TLS 1.3
+	Version string `json:"version,omitempty"`
+	// CipherSuite is the negotiated cipher suite
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	// ALPN is the negotiated application protocol, e.g. h2
+	ALPN string `json:"alpn,omitempty"`
+	// ServerName is the server name sent in the handshake, if any
+	ServerName string `json:"server_name,omitempty"`
+	// Subject is the common name of the certificate
+	Subject string `json:"subject,omitempty"`
+	// Issuer is the common name of the issuer of the certificate
+	Issuer string `json:"issuer,omitempty"`
+	// IssuerOrg is the organization of the issuer of the certificate
+	IssuerOrg string `json:"issuer_org,omitempty"`
+	// SANs contains the dns names of the certificate
+	SANs []string `json:"sans,omitempty"`
+}
+
+// tlsIssuerMatch contains the issuers of the certificates of a provider
+// along with the categories it is reported as
+type tlsIssuerMatch struct {
+	provider   string
+	categories []string
+	issuers    []*regexp.Regexp
+}
+
+// tlsIssuers returns the certificate issuers of the data with their enabled
+// categories sorted by provider, skipping the invalid ones
+func (o *clientOptions) tlsIssuers(data *InputCompiled, providers map[string]map[string]*customProvider) []*tlsIssuerMatch {
+	var matches []*tlsIssuerMatch
+	for _, provider := range slices.Sorted(maps.Keys(data.TLSIssuers)) {
+		categories := o.providerCategories(provider, data.TLSCategories[provider], defaultSuffixCategory, providers)
+		if len(categories) == 0 {
+			continue
+		}
+		match := &tlsIssuerMatch{provider: provider, categories: categories}
+		for _, issuer := range data.TLSIssuers[provider] {
+			if compiled, err := regexp.Compile("(?i)" + issuer); err == nil {
+				match.issuers = append(match.issuers, compiled)
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+// matchTLS sets the provider of the first certificate of the chain
+// matching the data to the result. The names of the leaf certificate are
+// checked against the suffixes of the providers, then the issuers of the
+// chain against the certificate issuers of the providers.
+func (idx *dataIndex) matchTLS(result *Result, certificates []*x509.Certificate) {
+	if len(certificates) == 0 {
+		return
+	}
+	leaf := certificates[0]
+	names := make([]string, 0, len(leaf.DNSNames)+1)
+	for _, name := range leaf.DNSNames {
+		names = append(names, "san:"+name)
+	}
+	if leaf.Subject.CommonName != "" {
+		names = append(names, "subject:"+leaf.Subject.CommonName)
+	}
+	for _, name := range names {
+		_, value, _ := strings.Cut(name, ":")
+		if match, ok := idx.suffixes.match(strings.TrimPrefix(value, "*.")); ok {
+			result.Matched = true
+			result.Category = match.categories[0]
+			result.Categories = slices.Clone(match.categories)
+			result.Provider = match.provider
+			result.Suffix = match.suffix
+			result.Fingerprint = name
+			result.Method = DetectionMethodTLS
+			return
+		}
+	}
+	for _, certificate := range certificates {
+		values := append(slices.Clone(certificate.Issuer.Organization), certificate.Issuer.CommonName)
+		for _, match := range idx.tlsIssuers {
+			for _, issuer := range match.issuers {
+				index := slices.IndexFunc(values, func(value string) bool { return value != "" && issuer.MatchString(value) })
+				if index < 0 {
+					continue
+				}
+				result.Matched = true
+				result.Category = match.categories[0]
+				result.Categories = slices.Clone(match.categories)
+				result.Provider = match.provider
+				result.Fingerprint = "issuer:" + values[index]
+				result.Method = DetectionMethodTLS
+				return
+			}
+		}
+	}
+}
+
+// CheckTLS connects to a host:port over tls and checks the certificate
+// chain it presents against the data. The certificate is not verified,
+// the host being sent as server name unless it is an ip.
+func (c *Client) CheckTLS(ctx context.Context, address string) (*Result, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %w", address, err)
+	}
+	config := &tls.Config{
+		// certificates of other hosts and expired ones identify providers as well
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	}
+	if net.ParseIP(host) == nil {
+		config.ServerName = host
+	}
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", address, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	state := conn.(*tls.Conn).ConnectionState()
+	result, err := c.CheckTLSState(&state)
+	if err != nil {
+		return nil, err
+	}
+	result.Input = address
+	return result, nil
+}
+
+// CheckTLSState is same as CheckTLS but checks the state of an already
+// established tls connection
+func (c *Client) CheckTLSState(state *tls.ConnectionState) (*Result, error) {
+	if state == nil {
+		return nil, errors.New("no tls connection state specified")
+	}
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		ServerName:  state.ServerName,
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		info.Subject = leaf.Subject.CommonName
+		info.Issuer = leaf.Issuer.CommonName
+		if len(leaf.Issuer.Organization) > 0 {
+			info.IssuerOrg = leaf.Issuer.Organization[0]
+		}
+		info.SANs = leaf.DNSNames
+	}
+	result := &Result{Input: state.ServerName, TLS: info}
+	index := c.index()
+	index.matchTLS(result, state.PeerCertificates)
+	return index.identify(result), nil
+}
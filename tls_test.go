@@ -0,0 +1,175 @@
+package cdncheck
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate returns a certificate for the names issued by a ca
+// with the issuer name
+func testCertificate(t *testing.T, issuer pkix.Name, subject string, names ...string) tls.Certificate {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err, "could not generate ca key")
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               issuer,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.Nil(t, err, "could not create ca certificate")
+	ca, err := x509.ParseCertificate(caDER)
+	require.Nil(t, err, "could not parse ca certificate")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err, "could not generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: subject},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.Nil(t, err, "could not create certificate")
+	return tls.Certificate{Certificate: [][]byte{der, caDER}, PrivateKey: key}
+}
+
+// tlsStandIn starts a tls server presenting the certificate and returns
+// its address along with the server names sent to it
+func tlsStandIn(t *testing.T, certificate tls.Certificate) (string, chan string) {
+	serverNames := make(chan string, 1)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		NextProtos: []string{"h2"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			serverNames <- hello.ServerName
+			return &certificate, nil
+		},
+	})
+	require.Nil(t, err, "could not listen")
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+	return listener.Addr().String(), serverNames
+}
+
+func TestCheckTLS(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	ca := pkix.Name{CommonName: "Example CA", Organization: []string{"Example"}}
+	tests := []struct {
+		name        string
+		issuer      pkix.Name
+		subject     string
+		sans        []string
+		provider    string
+		suffix      string
+		fingerprint string
+	}{
+		{name: "akamai", issuer: ca, subject: "a248.e.akamai.net", sans: []string{"a248.e.akamai.net", "*.akamaized.net"}, provider: "akamai", suffix: "akamaized.net", fingerprint: "san:*.akamaized.net"},
+		{name: "cloudfront", issuer: ca, subject: "*.cloudfront.net", provider: "amazon", suffix: "cloudfront.net", fingerprint: "subject:*.cloudfront.net"},
+		{name: "fastly", issuer: ca, subject: "example.com", sans: []string{"example.com", "*.global.ssl.fastly.net"}, provider: "fastly", suffix: "fastly.net", fingerprint: "san:*.global.ssl.fastly.net"},
+		{name: "cloudflare", issuer: pkix.Name{CommonName: "Cloudflare Inc ECC CA-3", Organization: []string{"Cloudflare, Inc."}}, subject: "example.com", sans: []string{"example.com"}, provider: "cloudflare", fingerprint: "issuer:Cloudflare, Inc."},
+		{name: "azure", issuer: pkix.Name{CommonName: "Microsoft Azure RSA TLS Issuing CA 04", Organization: []string{"Microsoft Corporation"}}, subject: "example.net", provider: "azure", fingerprint: "issuer:Microsoft Azure RSA TLS Issuing CA 04"},
+	}
+	for _, test := range tests {
+		address, _ := tlsStandIn(t, testCertificate(t, test.issuer, test.subject, test.sans...))
+		result, err := client.CheckTLS(t.Context(), address)
+		require.Nil(t, err, "could not check tls of %s server", test.name)
+		require.True(t, result.Matched, "could not match %s certificate", test.name)
+		require.Equal(t, test.provider, result.Provider, "could not get provider of %s certificate", test.name)
+		require.Equal(t, test.suffix, result.Suffix, "could not get suffix of %s certificate", test.name)
+		require.Equal(t, test.fingerprint, result.Fingerprint, "could not get evidence of %s certificate", test.name)
+		require.Equal(t, DetectionMethodTLS, result.Method, "could not get detection method of %s certificate", test.name)
+		require.Equal(t, address, result.Input, "could not get input of %s server", test.name)
+	}
+
+	address, serverNames := tlsStandIn(t, testCertificate(t, ca, "example.com", "example.com"))
+	result, err := client.CheckTLS(t.Context(), address)
+	require.Nil(t, err, "could not check tls")
+	require.False(t, result.Matched, "could match certificate of no provider")
+	require.Equal(t, "", <-serverNames, "could send server name for ip")
+	require.NotNil(t, result.TLS, "could not get handshake")
+	require.Equal(t, "TLS 1.3", result.TLS.Version, "could not get negotiated version")
+	require.NotEmpty(t, result.TLS.CipherSuite, "could not get negotiated cipher suite")
+	require.Equal(t, "h2", result.TLS.ALPN, "could not get negotiated protocol")
+	require.Equal(t, "example.com", result.TLS.Subject, "could not get subject")
+	require.Equal(t, "Example CA", result.TLS.Issuer, "could not get issuer")
+	require.Equal(t, "Example", result.TLS.IssuerOrg, "could not get issuer organization")
+	require.Equal(t, []string{"example.com"}, result.TLS.SANs, "could not get sans")
+
+	_, port, _ := net.SplitHostPort(address)
+	result, err = client.CheckTLS(t.Context(), net.JoinHostPort("localhost", port))
+	require.Nil(t, err, "could not check tls of name")
+	require.Equal(t, "localhost", <-serverNames, "could not send server name")
+	require.Equal(t, "localhost", result.TLS.ServerName, "could not get server name")
+
+	_, err = client.CheckTLS(t.Context(), "127.0.0.1")
+	require.NotNil(t, err, "could check address without port")
+	_, err = client.CheckTLSState(nil)
+	require.NotNil(t, err, "could check nil state")
+}
+
+func TestCheckTLSCustomData(t *testing.T) {
+	data := &InputCompiled{
+		Common:           map[string][]string{"edge": {"edge.example"}},
+		CommonCategories: map[string][]string{"edge": {"cdn"}},
+		TLSIssuers:       map[string][]string{"edge": {"^Edge Issuing CA"}, "shield": {"^Shield"}},
+		TLSCategories:    map[string][]string{"edge": {"cdn"}},
+	}
+	client, err := NewClient(WithData(data))
+	require.Nil(t, err, "could not create client")
+
+	// the intermediates of the chain are checked after the names of the leaf
+	leaf := testCertificate(t, pkix.Name{CommonName: "Edge Issuing CA 2"}, "www.example.com", "www.example.com")
+	intermediate, err := x509.ParseCertificate(testCertificate(t, pkix.Name{CommonName: "Shield Root"}, "Edge Issuing CA 2").Certificate[0])
+	require.Nil(t, err, "could not parse certificate")
+	parsed, err := x509.ParseCertificate(leaf.Certificate[0])
+	require.Nil(t, err, "could not parse certificate")
+	state := &tls.ConnectionState{Version: tls.VersionTLS12, PeerCertificates: []*x509.Certificate{parsed, intermediate}}
+	result, err := client.CheckTLSState(state)
+	require.Nil(t, err, "could not check tls state")
+	require.Equal(t, "edge", result.Provider, "could not match issuer of leaf")
+	require.Equal(t, "TLS 1.2", result.TLS.Version, "could not get version")
+
+	client, err = NewClient(WithData(data), WithCategories("waf"))
+	require.Nil(t, err, "could not create client")
+	result, err = client.CheckTLSState(state)
+	require.Nil(t, err, "could not check tls state")
+	require.Equal(t, "shield", result.Provider, "could not match issuer of intermediate")
+	require.Equal(t, "issuer:Shield Root", result.Fingerprint, "could not get issuer evidence")
+	require.Equal(t, "waf", result.Category, "could not get default category")
+
+	parsed, err = x509.ParseCertificate(testCertificate(t, pkix.Name{CommonName: "Other CA"}, "", "*.edge.example").Certificate[0])
+	require.Nil(t, err, "could not parse certificate")
+	client, err = NewClient(WithData(data), WithCategories("cdn"))
+	require.Nil(t, err, "could not create client")
+	result, err = client.CheckTLSState(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{parsed}})
+	require.Nil(t, err, "could not check tls state")
+	require.Equal(t, "edge", result.Provider, "could not match san suffix")
+	require.Equal(t, "san:*.edge.example", result.Fingerprint, "could not get san evidence")
+}
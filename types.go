@@ -3,8 +3,10 @@ package cdncheck
 import (
 	"net"
 	"net/netip"
+	"sort"
 
 	"github.com/gaissmai/bart"
+	"github.com/pkg/errors"
 )
 
 // InputCompiled contains a compiled list of input structure
@@ -15,42 +17,156 @@ type InputCompiled struct {
 	WAF map[string][]string `yaml:"waf,omitempty" json:"waf,omitempty"`
 	// Cloud contains a list of ranges for Cloud cidrs
 	Cloud map[string][]string `yaml:"cloud,omitempty" json:"cloud,omitempty"`
+	// Ranges contains the ranges of the categories other than cdn, waf and cloud
+	Ranges map[string]map[string][]string `yaml:"ranges,omitempty" json:"ranges,omitempty"`
+	// Categories contains the categories declared by the data in check order
+	Categories []CategoryInfo `yaml:"categories,omitempty" json:"categories,omitempty"`
 	// Common contains a list of suffixes for major sources
 	Common map[string][]string `yaml:"common,omitempty" json:"common,omitempty"`
+	// CommonCategories contains the categories of the suffixes of each source in Common
+	CommonCategories map[string][]string `yaml:"common_categories,omitempty" json:"common_categories,omitempty"`
+	// Fingerprints contains the http response fingerprints of each provider
+	Fingerprints map[string][]HTTPFingerprint `yaml:"fingerprints,omitempty" json:"fingerprints,omitempty"`
+	// FingerprintCategories contains the categories of each provider in Fingerprints
+	FingerprintCategories map[string][]string `yaml:"fingerprint_categories,omitempty" json:"fingerprint_categories,omitempty"`
+	// TLSIssuers contains the regular expressions matching the issuers of
+	// the certificates of each provider
+	TLSIssuers map[string][]string `yaml:"tls_issuers,omitempty" json:"tls_issuers,omitempty"`
+	// TLSCategories contains the categories of each provider in TLSIssuers
+	TLSCategories map[string][]string `yaml:"tls_categories,omitempty" json:"tls_categories,omitempty"`
+	// Nameservers contains the nameserver patterns of each dns provider,
+	// e.g. awsdns-*.com
+	Nameservers map[string][]string `yaml:"nameservers,omitempty" json:"nameservers,omitempty"`
+	// NameserverCategories contains the categories of each provider in
+	// Nameservers, dns if none
+	NameserverCategories map[string][]string `yaml:"nameserver_categories,omitempty" json:"nameserver_categories,omitempty"`
+	// BlockFingerprints contains the fingerprints of the block pages of each waf
+	BlockFingerprints map[string][]HTTPFingerprint `yaml:"block_fingerprints,omitempty" json:"block_fingerprints,omitempty"`
+	// Metadata describes when and how the data was generated
+	Metadata *Metadata `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	// ASN contains the ip to asn table sorted by number
+	ASN []AutonomousSystem `yaml:"asn,omitempty" json:"asn,omitempty"`
+	// Registry contains the description of the providers sorted by id
+	Registry []ProviderInfo `yaml:"registry,omitempty" json:"registry,omitempty"`
+
+	// parsed contains the ranges of each category decoded from a binary
+	// index, used instead of parsing the cidrs of the categories again
+	parsed map[string]map[string][]netip.Prefix
+}
+
+// Match contains a single provider match for an IP
+type Match struct {
+	// Category is the category of the match (cdn, waf, cloud)
+	Category string `json:"category"`
+	// Provider is the name of the matched provider
+	Provider string `json:"provider"`
+	// Path is the hierarchical name of the service and region of the
+	// provider containing the IP, e.g. aws/ec2/us-east-1, if known
+	Path string `json:"path,omitempty"`
+	// Prefix is the most specific CIDR of the provider containing the IP
+	Prefix string `json:"prefix"`
 }
 
 // providerScraper is a structure for scraping providers
+//
+// All the ranges of a category are kept in a single longest-prefix-match
+// table whose payload holds the providers owning each prefix, so a lookup
+// is a single walk returning the most specific owner of an IP.
 type providerScraper struct {
-	rangers map[string]*bart.Table[net.IP]
+	ranger *bart.Table[[]string]
 }
 
 // newProviderScraper returns a new provider scraper instance
 func newProviderScraper(ranges map[string][]string) *providerScraper {
-	scraper := &providerScraper{rangers: make(map[string]*bart.Table[net.IP])}
+	parsed := make(map[string][]netip.Prefix, len(ranges))
+	for provider, cidrs := range ranges {
+		parsed[provider] = parsePrefixes(cidrs)
+	}
+	return newPrefixScraper(parsed)
+}
 
-	for provider, items := range ranges {
-		ranger := new(bart.Table[net.IP])
-		for _, cidr := range items {
-			if network, err := netip.ParsePrefix(cidr); err == nil {
-				ranger.Insert(network, nil)
-			}
+// newPrefixScraper returns a new provider scraper of parsed ranges
+func newPrefixScraper(ranges map[string][]netip.Prefix) *providerScraper {
+	scraper := &providerScraper{ranger: new(bart.Table[[]string])}
+
+	// providers are inserted in sorted order so payloads stay sorted
+	// and overlapping prefixes resolve to the same owner on every run.
+	providers := make([]string, 0, len(ranges))
+	for provider := range ranges {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	for _, provider := range providers {
+		for _, network := range ranges[provider] {
+			scraper.ranger.Modify(network.Masked(), func(owners []string, _ bool) ([]string, bool) {
+				if len(owners) > 0 && owners[len(owners)-1] == provider {
+					return owners, false
+				}
+				return append(owners, provider), false
+			})
 		}
-		scraper.rangers[provider] = ranger
 	}
 	return scraper
 }
 
 // Match returns true if the IP matches provided CIDR ranges
 func (p *providerScraper) Match(ip net.IP) (bool, string, error) {
-	parsed, err := netip.ParseAddr(ip.String())
+	parsed, err := toAddr(ip)
 	if err != nil {
 		return false, "", err
 	}
 
-	for provider, ranger := range p.rangers {
-		if _, contains := ranger.Lookup(parsed); contains {
-			return true, provider, err
-		}
+	if owners, contains := p.ranger.Lookup(parsed); contains {
+		provider, _ := SplitProviderPath(owners[0])
+		return true, provider, nil
 	}
 	return false, "", nil
 }
+
+// lookup returns the most specific provider and prefix containing the
+// address, the provider being the hierarchical name it has in the data
+func (p *providerScraper) lookup(addr netip.Addr) (netip.Prefix, string, bool) {
+	prefix, owners, contains := p.ranger.LookupPrefixLPM(netip.PrefixFrom(addr, addr.BitLen()))
+	if !contains {
+		return netip.Prefix{}, "", false
+	}
+	return prefix, owners[0], true
+}
+
+// MatchAll returns every provider whose CIDR ranges contain the IP
+// sorted by provider name along with the most specific matched prefix
+// and the path of the service and region it belongs to.
+func (p *providerScraper) MatchAll(ip net.IP) ([]Match, error) {
+	parsed, err := toAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	seen := make(map[string]struct{})
+	// supernets are walked from the most to the least specific prefix
+	for prefix, owners := range p.ranger.Supernets(netip.PrefixFrom(parsed, parsed.BitLen())) {
+		for _, owner := range owners {
+			provider, path := providerMatch(owner)
+			if _, ok := seen[provider]; ok {
+				continue
+			}
+			seen[provider] = struct{}{}
+			matches = append(matches, Match{Provider: provider, Path: path, Prefix: prefix.String()})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Provider < matches[j].Provider
+	})
+	return matches, nil
+}
+
+// toAddr converts a net.IP into its netip.Addr form
+func toAddr(ip net.IP) (netip.Addr, error) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Addr{}, errors.Errorf("invalid ip address %q", ip.String())
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,197 @@
+package cdncheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// wafUserAgent is the user agent of the requests probing for a waf
+const wafUserAgent = "Mozilla/5.0 (compatible; cdncheck)"
+
+// wafPayload is a query parameter carrying a benign attack pattern which
+// wafs commonly block. The patterns do nothing on the probed host.
+type wafPayload struct {
+	name  string
+	param string
+	value string
+}
+
+// wafPayloads are the requests sent in order to probe a host for a waf
+var wafPayloads = []wafPayload{
+	{name: "xss", param: "q", value: "<script>alert(1)</script>"},
+	{name: "sqli", param: "id", value: "1' OR '1'='1' --"},
+	{name: "traversal", param: "file", value: "../../../../etc/passwd"},
+	{name: "command", param: "cmd", value: "; cat /etc/passwd"},
+}
+
+// blockStatuses are the status codes wafs commonly answer blocked
+// requests with
+var blockStatuses = []int{
+	http.StatusForbidden,
+	http.StatusNotAcceptable,
+	419,
+	http.StatusTooManyRequests,
+	http.StatusNotImplemented,
+	http.StatusServiceUnavailable,
+}
+
+// WAFResult is the result of actively probing a host for a waf, the
+// vendor being reported as the provider of the result
+type WAFResult struct {
+	Result
+	// Blocked is true if a request with an attack pattern was blocked
+	Blocked bool `json:"blocked"`
+	// Payload is the name of the first blocked request, e.g. xss
+	Payload string `json:"payload,omitempty"`
+	// Status is the status code of the first blocked response
+	Status int `json:"status,omitempty"`
+}
+
+// blockFingerprints returns the block page fingerprints of the data
+// sorted by provider, or nil if the waf category is not enabled
+func (o *clientOptions) blockFingerprints(data *InputCompiled, providers map[string]map[string]*customProvider) []*fingerprintMatch {
+	if !o.enabled("waf") {
+		return nil
+	}
+	var matches []*fingerprintMatch
+	for _, provider := range slices.Sorted(maps.Keys(data.BlockFingerprints)) {
+		// a replaced waf provider loses its block pages along with its ranges
+		if custom, ok := providers["waf"][provider]; ok && custom.replace {
+			continue
+		}
+		matches = append(matches, &fingerprintMatch{
+			provider:     provider,
+			categories:   []string{"waf"},
+			fingerprints: compileFingerprints(data.BlockFingerprints[provider]),
+		})
+	}
+	return matches
+}
+
+// wafResponse is a response to a probe request with the start of its body
+type wafResponse struct {
+	*http.Response
+	body []byte
+}
+
+// wafRequest sends a probe request and reads the start of the response body
+func wafRequest(ctx context.Context, client *http.Client, target *url.URL) (*wafResponse, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", wafUserAgent)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxFingerprintBody))
+	if err != nil {
+		return nil, fmt.Errorf("could not read response body: %w", err)
+	}
+	return &wafResponse{Response: response, body: body}, nil
+}
+
+// classify identifies the vendor of the waf from a response and returns
+// true if the response is a block page
+func (idx *dataIndex) classify(result *WAFResult, response *wafResponse) bool {
+	if match, fingerprint, ok := matchFingerprints(idx.blockFingerprints, response.Response, response.body); ok {
+		if !result.Matched || result.Method != DetectionMethodBlock {
+			result.setVendor(match, fingerprint, DetectionMethodBlock)
+		}
+		return true
+	}
+	if result.Matched {
+		return false
+	}
+	// providers which are wafs can be identified from any of their responses
+	for _, match := range idx.fingerprints {
+		if !slices.Contains(match.categories, "waf") {
+			continue
+		}
+		if match, fingerprint, ok := matchFingerprints([]*fingerprintMatch{match}, response.Response, response.body); ok {
+			result.setVendor(match, fingerprint, DetectionMethodHTTP)
+			break
+		}
+	}
+	return false
+}
+
+// setVendor sets the provider of a fingerprint as the vendor of the waf
+func (result *WAFResult) setVendor(match *fingerprintMatch, fingerprint *httpFingerprint, method DetectionMethod) {
+	result.Matched = true
+	result.Category = "waf"
+	result.Categories = []string{"waf"}
+	result.Provider = match.provider
+	result.Fingerprint = fingerprint.String()
+	result.Method = method
+}
+
+// DetectWAF actively probes an http or https url for a waf. A request
+// without payload is sent first, followed by requests carrying benign
+// attack patterns in their query. A response is considered blocked when
+// it matches the block page fingerprints of a vendor, or when its status
+// is one wafs block with while the first request got another one.
+//
+// The vendor is identified from the block pages or from the http
+// fingerprints of the providers which are wafs. The requests are sent with
+// the http client, http.DefaultClient being used if nil.
+func (c *Client) DetectWAF(ctx context.Context, client *http.Client, target string) (*WAFResult, error) {
+	base, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse url %s: %w", target, err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid url %s specified", target)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	index := c.index()
+	result := &WAFResult{Result: Result{Input: target}}
+
+	baseline, err := wafRequest(ctx, client, base)
+	if err != nil {
+		return nil, fmt.Errorf("could not request %s: %w", target, err)
+	}
+	// a block page without payload identifies the vendor only
+	_ = index.classify(result, baseline)
+
+	for _, payload := range wafPayloads {
+		if result.Blocked && result.Method == DetectionMethodBlock {
+			break
+		}
+		probe := *base
+		query := probe.Query()
+		query.Set(payload.param, payload.value)
+		probe.RawQuery = query.Encode()
+
+		response, err := wafRequest(ctx, client, &probe)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// some wafs reset the connection of blocked requests
+			continue
+		}
+		blocked := index.classify(result, response)
+		if !blocked && slices.Contains(blockStatuses, response.StatusCode) && response.StatusCode != baseline.StatusCode {
+			blocked = true
+		}
+		if blocked && !result.Blocked {
+			result.Blocked = true
+			result.Payload = payload.name
+			result.Status = response.StatusCode
+		}
+	}
+	index.identify(&result.Result)
+	return result, nil
+}
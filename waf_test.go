@@ -0,0 +1,140 @@
+package cdncheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// wafStandIn returns a server answering the requests carrying a query with
+// the block page of a waf and the others with a plain page
+func wafStandIn(block func(w http.ResponseWriter)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "" && block != nil {
+			block(w)
+			return
+		}
+		_, _ = w.Write([]byte("<html><body>welcome</body></html>"))
+	}))
+}
+
+// blockPage returns a block page with the headers, status and body
+func blockPage(status int, body string, headers ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Add(headers[i], headers[i+1])
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func TestDetectWAF(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	tests := []struct {
+		name   string
+		block  func(w http.ResponseWriter)
+		vendor string
+	}{
+		{name: "cloudflare", vendor: "cloudflare", block: blockPage(403, "<title>Attention Required! | Cloudflare</title>", "CF-RAY", "8a1b2c3d4e5f6789-FRA")},
+		{name: "akamai", vendor: "akamai", block: blockPage(403, "<H1>Access Denied</H1>Reference&#32;&#35;18&#46;2f1c1002&#46;1700000000&#46;5e8c", "Server", "AkamaiGHost")},
+		{name: "incapsula", vendor: "incapsula", block: blockPage(200, `<iframe src="/_Incapsula_Resource?CWUDNSAI=1">Request unsuccessful. Incapsula incident ID: 1-2</iframe>`)},
+		{name: "sucuri", vendor: "sucuri", block: blockPage(403, "<title>Sucuri WebSite Firewall - Access Denied</title>", "X-Sucuri-Block", "XSS01")},
+		{name: "aws-waf", vendor: "aws-waf", block: blockPage(403, "<title>403 Forbidden</title>", "Server", "awselb/2.0")},
+		{name: "modsecurity", vendor: "modsecurity", block: blockPage(406, "This error was generated by Mod_Security.")},
+		{name: "f5", vendor: "f5", block: blockPage(200, "<title>Request Rejected</title>The requested URL was rejected. Please consult with your administrator.")},
+		{name: "barracuda", vendor: "barracuda", block: blockPage(200, "blocked", "Set-Cookie", "barra_counter_session=1; Path=/")},
+		{name: "wordfence", vendor: "wordfence", block: blockPage(503, "Your access to this site has been limited by the site owner. Generated by Wordfence")},
+		{name: "unknown", block: blockPage(403, "forbidden")},
+	}
+	for _, test := range tests {
+		server := wafStandIn(test.block)
+		result, err := client.DetectWAF(t.Context(), server.Client(), server.URL)
+		server.Close()
+		require.Nil(t, err, "could not probe %s waf", test.name)
+		require.True(t, result.Blocked, "could not observe blocking of %s waf", test.name)
+		require.Equal(t, "xss", result.Payload, "could not get blocked payload of %s waf", test.name)
+		require.Equal(t, test.vendor, result.Provider, "could not get vendor of %s waf", test.name)
+		require.Equal(t, test.vendor != "", result.Matched, "could not match vendor of %s waf", test.name)
+		if test.vendor != "" {
+			require.Equal(t, DetectionMethodBlock, result.Method, "could not get detection method of %s waf", test.name)
+			require.Equal(t, "waf", result.Category, "could not get category of %s waf", test.name)
+		}
+	}
+}
+
+func TestDetectWAFNotBlocked(t *testing.T) {
+	client, err := New()
+	require.Nil(t, err, "could not create client")
+
+	server := wafStandIn(nil)
+	result, err := client.DetectWAF(t.Context(), server.Client(), server.URL+"/path?page=1")
+	server.Close()
+	require.Nil(t, err, "could not probe server")
+	require.False(t, result.Blocked, "could observe blocking without waf")
+	require.False(t, result.Matched, "could match vendor without waf")
+
+	// a vendor is identified from the fingerprints of its plain responses
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("CF-RAY", "8a1b2c3d4e5f6789-FRA")
+	}))
+	result, err = client.DetectWAF(t.Context(), server.Client(), server.URL)
+	server.Close()
+	require.Nil(t, err, "could not probe server")
+	require.False(t, result.Blocked, "could observe blocking of allowed requests")
+	require.Equal(t, "cloudflare", result.Provider, "could not get vendor from http fingerprints")
+	require.Equal(t, DetectionMethodHTTP, result.Method, "could not get detection method")
+
+	// a host answering every request with the same status does not block
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	result, err = client.DetectWAF(t.Context(), server.Client(), server.URL)
+	server.Close()
+	require.Nil(t, err, "could not probe server")
+	require.False(t, result.Blocked, "could observe blocking of forbidden host")
+
+	_, err = client.DetectWAF(t.Context(), nil, "ftp://example.com")
+	require.NotNil(t, err, "could probe url of another scheme")
+}
+
+func TestDetectWAFCustomData(t *testing.T) {
+	data := &InputCompiled{
+		BlockFingerprints: map[string][]HTTPFingerprint{
+			"shield": {{Header: "X-Shield", Status: []int{403}, Body: `blocked by shield \d+`}},
+		},
+	}
+	var payloads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payloads = append(payloads, r.URL.RawQuery)
+		w.Header().Set("X-Shield", "1")
+		if strings.Contains(r.URL.Query().Get("id"), "'") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("Blocked by Shield 42"))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithData(data))
+	require.Nil(t, err, "could not create client")
+	result, err := client.DetectWAF(t.Context(), server.Client(), server.URL)
+	require.Nil(t, err, "could not probe server")
+	require.True(t, result.Blocked, "could not observe blocking")
+	require.Equal(t, "sqli", result.Payload, "could not get blocked payload")
+	require.Equal(t, http.StatusForbidden, result.Status, "could not get blocked status")
+	require.Equal(t, "shield", result.Provider, "could not get vendor")
+	require.Equal(t, `header:x-shield status:403 body:blocked by shield \d+`, result.Fingerprint, "could not get fingerprint")
+	require.Len(t, payloads, 3, "could not stop after the vendor was identified")
+
+	client, err = NewClient(WithData(data), WithCategories("cdn"))
+	require.Nil(t, err, "could not create client")
+	result, err = client.DetectWAF(t.Context(), server.Client(), server.URL)
+	require.Nil(t, err, "could not probe server")
+	require.True(t, result.Blocked, "could not observe blocking with waf category disabled")
+	require.False(t, result.Matched, "could match vendor of disabled category")
+}